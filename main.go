@@ -2,6 +2,8 @@ package main
 
 import (
 	"github.com/stevenmahana/ApiMainTemplate/src/controllers"
+	"github.com/stevenmahana/ApiMainTemplate/src/cors"
+	"github.com/stevenmahana/ApiMainTemplate/src/compress"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 	"log"
@@ -23,19 +25,59 @@ func main() {
 	router := httprouter.New()
 	ctlr := controllers.NewController()
 
+	// live service registry; micro services announce themselves on DISCOVERY_SUBJECT
+	if err := ctlr.Discover(); err != nil {
+		log.Println(">>> ERROR: Service Discovery error - ", err)
+	}
+
 	// public routes
 	router.GET("/", ctlr.Index)
+	router.GET("/docs", ctlr.DocsController)
+	router.GET("/docs/:object", ctlr.DocsController)
 
 	// secure routes
+	router.GET("/services", ctlr.ServicesController)
+	router.GET("/metrics", ctlr.MetricsController)
 	router.GET("/service/:object/:method", ctlr.GetController)
 	router.POST("/service/:object/:method", ctlr.CreateController)
 	router.PUT("/service/:object/:method", ctlr.UpdateController)
+	router.PATCH("/service/:object/:method", ctlr.PatchController)
 	router.DELETE("/service/:object/:method", ctlr.RemoveController)
+	router.HEAD("/service/:object/:method", ctlr.HeadController)
+	router.OPTIONS("/service/:object/:method", ctlr.OptionsController)
+
+	// status and result of async requests (?async=true or Prefer: respond-async)
+	router.GET("/jobs/:id", ctlr.JobController)
+
+	// several service calls in one request
+	router.POST("/batch", ctlr.BatchController)
+
+	// several services joined into one document, configured in COMPOSITES_FILE
+	router.GET("/composite/:name", ctlr.CompositeController)
+
+	// GraphQL facade over the generic service routes
+	router.GET("/graphql", ctlr.GraphQLController)
+	router.POST("/graphql", ctlr.GraphQLController)
+
+	// live object changes as server-sent events
+	router.GET("/events/:object", ctlr.EventsController)
+
+	// webhook subscriptions; object events are POSTed to the registered URLs
+	router.GET("/webhooks", ctlr.WebhooksController)
+	router.POST("/webhooks", ctlr.WebhooksController)
+	router.GET("/webhooks/:id", ctlr.WebhookController)
+	router.DELETE("/webhooks/:id", ctlr.WebhookController)
+	router.GET("/webhooks/:id/:log", ctlr.WebhookLogController)
+
+	// requests, replies and object events over a WebSocket
+	router.GET("/ws", ctlr.WebSocketController)
 
 	// file or binary upload. requires POST method and object, object uuid
 	router.POST("/upload/:object/:uuid", ctlr.UploadController)
 
 	log.Print("Server is running on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", router))
+	// CORS is handled before routing so preflight requests never reach the secure routes
+	// responses are compressed with the encoding the client accepts (COMPRESS_*)
+	log.Fatal(http.ListenAndServe(":8080", cors.FromEnv().Handler(compress.FromEnv().Handler(router))))
 
 }
\ No newline at end of file
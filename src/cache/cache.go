@@ -0,0 +1,419 @@
+package cache
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/events"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"sort"
+	"sync"
+	"time"
+	"log"
+	"os"
+)
+
+/*
+	Cache keeps the replies of GET requests so repeated reads don't reach the service.
+
+	Replies are keyed by subject, method, the normalized query (sorted, output params removed), the user
+	and the forwarded headers; replies are never shared between users. Only 200 replies are kept.
+	The service controls caching with Cache-Control: no-store and no-cache keep the reply out of the cache,
+	max-age (or s-maxage) replaces the TTL of the object. private replies are kept, they are never shared.
+	Every cached reply carries an ETag, the one the service sent or a hash of the body.
+
+	The replies of an object are dropped on every change event of the object (EVENTS_PREFIX), and when
+	events could have been missed.
+
+	CACHE_TTL: seconds replies of every object are kept. Default = 0, not cached
+	CACHE_RULES: per object TTLs in seconds, they win over CACHE_TTL. ex: person=30,account=0
+	CACHE_MAX_ENTRIES: replies kept, the ones closest to expiring are dropped first. Default = 10000
+	CACHE_MAX_BODY: largest reply body in bytes that is kept. Default = 1000000
+ */
+type Cache struct {
+	TTL 		time.Duration
+	Rules 		map[string]time.Duration
+	MaxEntries 	int
+	MaxBody 	int
+
+	hub 		*events.Hub
+	mu 		sync.Mutex
+	entries 	map[string]*entry
+	expiry 		expiry 				// the entries, the one closest to expiring first
+	objects 	map[string]map[string]bool 	// keys of the entries of every object
+	generations 	map[string]uint64 		// invalidations of every object
+	watching 	map[string]bool 		// objects with an invalidation watcher
+}
+
+type entry struct {
+	key 		string
+	object 		string
+	reply 		models.Reply
+	stored 		time.Time
+	expires 	time.Time
+	index 		int 		// position in the expiry heap
+}
+
+// expiry is a min heap of the entries by expiry time, see container/heap
+type expiry []*entry
+
+func (h expiry) Len() int { return len(h) }
+func (h expiry) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h expiry) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *expiry) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *expiry) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// New creates an empty cache that drops replies on the change events of hub
+func New(hub *events.Hub, ttl time.Duration) *Cache {
+	return &Cache{
+		TTL: ttl,
+		Rules: map[string]time.Duration{},
+		MaxEntries: 10000,
+		MaxBody: 1000000,
+		hub: hub,
+		entries: map[string]*entry{},
+		objects: map[string]map[string]bool{},
+		generations: map[string]uint64{},
+		watching: map[string]bool{},
+	}
+}
+
+// FromEnv creates the cache from the CACHE_* variables
+func FromEnv(hub *events.Hub) *Cache {
+
+	c := New(hub, time.Duration(envInt("CACHE_TTL", 0)) * time.Second)
+	c.MaxEntries = envInt("CACHE_MAX_ENTRIES", c.MaxEntries)
+	c.MaxBody = envInt("CACHE_MAX_BODY", c.MaxBody)
+
+	for _, rule := range strings.Split(os.Getenv("CACHE_RULES"), ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		seconds, err := strconv.Atoi(strings.TrimSpace(parts[len(parts)-1]))
+		if len(parts) != 2 || err != nil || seconds < 0 {
+			log.Println(">>> ERROR: CACHE_RULES invalid rule " + rule)
+			continue
+		}
+		c.Rules[strings.TrimSpace(parts[0])] = time.Duration(seconds) * time.Second
+	}
+
+	return c
+}
+
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n >= 0 {
+		return n
+	}
+	return fallback
+}
+
+// Enabled reports whether replies of the object are cached
+func (c *Cache) Enabled(object string) bool {
+	return c.ttl(object) > 0
+}
+
+func (c *Cache) ttl(object string) time.Duration {
+	if ttl, ok := c.Rules[object]; ok {
+		return ttl
+	}
+	return c.TTL
+}
+
+// skipped are the params that change the response but not the reply of the service
+var skipped = []string{"format", "async"}
+
+// conditional are the headers that are answered from the stored reply (see NotModified), they don't change it
+var conditional = []string{"if-none-match", "if-match", "if-modified-since", "if-unmodified-since"}
+
+// Key identifies a request: subject, method, normalized query, user and forwarded headers, except the conditional ones
+func Key(subject string, method string, query url.Values, auid string, headers map[string]string) string {
+
+	q := url.Values{}
+	for name, values := range query {
+		q[name] = values
+	}
+	for _, name := range skipped {
+		q.Del(name)
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if isConditional(name) == false {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, part := range []string{subject, method, q.Encode(), auid} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	for _, name := range names {
+		h.Write([]byte(name + ":" + header(headers, name)))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func isConditional(name string) bool {
+	for _, c := range conditional {
+		if strings.EqualFold(name, c) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Get returns a copy of the fresh reply stored for the key, with the Age and X-Cache: HIT headers.
+ */
+func (c *Cache) Get(key string) (models.Reply, bool) {
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && time.Now().After(e.expires) {
+		c.remove(key)
+		ok = false
+	}
+	var reply models.Reply
+	var stored time.Time
+	if ok {
+		reply, stored = copyReply(e.reply), e.stored
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return models.Reply{}, false
+	}
+
+	reply.Headers["Age"] = strconv.Itoa(int(time.Since(stored).Seconds()))
+	reply.Headers["X-Cache"] = "HIT"
+	return reply, true
+}
+
+// Generation changes every time the object is invalidated, read it before sending the request the reply answers
+func (c *Cache) Generation(object string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generations[object]
+}
+
+/*
+	Put stores the reply of the object when it can be cached, and returns it with its ETag,
+	its Cache-Control (private, max-age=<ttl> when the service sent none) and X-Cache: MISS.
+	A reply sent before the object was last invalidated (generation is older) is not stored.
+ */
+func (c *Cache) Put(key string, object string, generation uint64, reply models.Reply) models.Reply {
+
+	reply = copyReply(reply)
+	reply.Headers["X-Cache"] = "MISS"
+
+	if reply.Status != 0 && reply.Status != 200 {
+		return reply
+	}
+
+	if header(reply.Headers, "ETag") == "" {
+		reply.Headers["ETag"] = ETag(reply.Body)
+	}
+
+	ttl := c.ttl(object)
+	if control := header(reply.Headers, "Cache-Control"); control != "" {
+		directives := parseControl(control)
+		for _, directive := range []string{"no-store", "no-cache"} {
+			if _, ok := directives[directive]; ok {
+				return reply
+			}
+		}
+		if seconds, ok := directives["s-maxage"]; ok {
+			ttl = seconds
+		} else if seconds, ok := directives["max-age"]; ok {
+			ttl = seconds
+		}
+	} else {
+		reply.Headers["Cache-Control"] = "private, max-age=" + strconv.Itoa(int(ttl.Seconds()))
+	}
+
+	// replies are only kept while change events can drop them
+	if ttl <= 0 || len(reply.Body) > c.MaxBody || !c.watch(object) {
+		return reply
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	if c.generations[object] != generation {
+		c.mu.Unlock()
+		return reply
+	}
+	c.remove(key)
+	if len(c.entries) >= c.MaxEntries {
+		c.evict(now)
+	}
+	e := &entry{key: key, object: object, reply: copyReply(reply), stored: now, expires: now.Add(ttl)}
+	c.entries[key] = e
+	heap.Push(&c.expiry, e)
+	if c.objects[object] == nil {
+		c.objects[object] = map[string]bool{}
+	}
+	c.objects[object][key] = true
+	c.mu.Unlock()
+
+	return reply
+}
+
+// Invalidate drops every reply of the object
+func (c *Cache) Invalidate(object string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.objects[object] {
+		c.remove(key)
+	}
+	delete(c.objects, object)
+	c.generations[object]++
+}
+
+// evict drops the expired entries, or the one closest to expiring when none is. Called with mu held
+func (c *Cache) evict(now time.Time) {
+
+	for len(c.expiry) > 0 && now.After(c.expiry[0].expires) {
+		c.remove(c.expiry[0].key)
+	}
+
+	for len(c.expiry) > 0 && len(c.entries) >= c.MaxEntries {
+		c.remove(c.expiry[0].key)
+	}
+}
+
+// remove drops one entry. Called with mu held
+func (c *Cache) remove(key string) {
+	if e, ok := c.entries[key]; ok {
+		delete(c.objects[e.object], key)
+		delete(c.entries, key)
+		heap.Remove(&c.expiry, e.index)
+	}
+}
+
+/*
+	watch drops the replies of the object on every change event, and reports whether it is watching.
+	When the watcher is dropped as a slow consumer events may have been missed, so the object is dropped too.
+ */
+func (c *Cache) watch(object string) bool {
+
+	c.mu.Lock()
+	watching := c.watching[object]
+	c.mu.Unlock()
+	if watching {
+		return true
+	}
+
+	sub, err := c.hub.Subscribe(object, "")
+	if err != nil {
+		log.Println(">>> ERROR: Cache Subscribe Error - ", err)
+		return false
+	}
+
+	c.mu.Lock()
+	if c.watching[object] {
+		c.mu.Unlock()
+		sub.Close()
+		return true
+	}
+	c.watching[object] = true
+	c.mu.Unlock()
+
+	go func() {
+		for range sub.Events {
+			c.Invalidate(object)
+		}
+
+		// the next reply of the object watches again
+		c.mu.Lock()
+		c.watching[object] = false
+		c.mu.Unlock()
+		c.Invalidate(object)
+	}()
+
+	return true
+}
+
+// ETag is the strong entity tag of a reply body
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "\"" + hex.EncodeToString(sum[:16]) + "\""
+}
+
+// NotModified reports whether If-None-Match lists the ETag, compared weakly as RFC 7232 requires
+func NotModified(ifNoneMatch string, etag string) bool {
+
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseControl reads the Cache-Control directives, with their seconds for max-age and s-maxage
+func parseControl(control string) map[string]time.Duration {
+
+	directives := map[string]time.Duration{}
+	for _, directive := range strings.Split(control, ",") {
+		parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		name := strings.ToLower(parts[0])
+		var seconds int
+		if len(parts) == 2 {
+			seconds, _ = strconv.Atoi(strings.Trim(parts[1], "\""))
+		}
+		directives[name] = time.Duration(seconds) * time.Second
+	}
+	return directives
+}
+
+// header returns a reply header, names are case insensitive
+func header(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func copyReply(reply models.Reply) models.Reply {
+	headers := make(map[string]string, len(reply.Headers) + 4)
+	for name, value := range reply.Headers {
+		headers[name] = value
+	}
+	reply.Headers = headers
+	return reply
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"container/heap"
+	"testing"
+	"time"
+)
+
+// cache is a cache without a hub; its objects are marked as watched so Put doesn't subscribe
+func cache(max int, objects ...string) *Cache {
+	c := New(nil, time.Minute)
+	c.MaxEntries = max
+	for _, object := range objects {
+		c.watching[object] = true
+	}
+	return c
+}
+
+func put(c *Cache, key string, object string, maxAge string) {
+	c.Put(key, object, c.Generation(object), models.Reply{Status: 200, Headers: map[string]string{"Cache-Control": "max-age=" + maxAge}, Body: []byte(key)})
+}
+
+func TestEvictClosestToExpiring(t *testing.T) {
+
+	c := cache(3, "person")
+	put(c, "a", "person", "30")
+	put(c, "b", "person", "10")
+	put(c, "c", "person", "20")
+	put(c, "b", "person", "40") // stored again, now expires last
+
+	put(c, "d", "person", "50")
+
+	if _, ok := c.Get("c"); ok {
+		t.Fatal("the entry closest to expiring was kept")
+	}
+	for _, key := range []string{"a", "b", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Fatalf("%s was evicted", key)
+		}
+	}
+	if len(c.expiry) != len(c.entries) {
+		t.Fatalf("heap has %d entries, the cache %d", len(c.expiry), len(c.entries))
+	}
+}
+
+func TestEvictExpiredFirst(t *testing.T) {
+
+	c := cache(2, "person")
+	put(c, "a", "person", "60")
+	put(c, "b", "person", "60")
+	c.entries["b"].expires = time.Now().Add(-time.Second)
+	heap.Fix(&c.expiry, c.entries["b"].index)
+
+	put(c, "c", "person", "60")
+
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a fresh entry was evicted before an expired one")
+	}
+	if _, ok := c.entries["b"]; ok {
+		t.Fatal("the expired entry was kept")
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+
+	c := cache(10, "person", "account")
+	put(c, "p1", "person", "60")
+	put(c, "p2", "person", "60")
+	put(c, "a1", "account", "60")
+	generation := c.Generation("person")
+
+	c.Invalidate("person")
+
+	if _, ok := c.Get("p1"); ok {
+		t.Fatal("reply of an invalidated object was kept")
+	}
+	if _, ok := c.Get("a1"); !ok {
+		t.Fatal("reply of another object was dropped")
+	}
+	if len(c.expiry) != 1 {
+		t.Fatalf("heap has %d entries, want 1", len(c.expiry))
+	}
+
+	// a reply read before the invalidation is not stored
+	c.Put("p1", "person", generation, models.Reply{Status: 200, Body: []byte("old")})
+	if _, ok := c.Get("p1"); ok {
+		t.Fatal("reply older than the invalidation was stored")
+	}
+}
+
+func TestKeyIgnoresConditionalHeaders(t *testing.T) {
+
+	plain := Key("person", "get", nil, "u1", map[string]string{"Accept-Language": "en"})
+	conditional := Key("person", "get", nil, "u1", map[string]string{"Accept-Language": "en", "If-None-Match": `"abc"`, "if-match": "*"})
+	if plain != conditional {
+		t.Fatal("conditional headers changed the key")
+	}
+	if plain == Key("person", "get", nil, "u1", map[string]string{"Accept-Language": "fr"}) {
+		t.Fatal("forwarded headers don't change the key")
+	}
+}
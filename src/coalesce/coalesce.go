@@ -0,0 +1,122 @@
+package coalesce
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"sync/atomic"
+	"errors"
+	"sync"
+	"os"
+)
+
+/*
+	Group shares one service round trip between identical requests that are in flight at the same time.
+
+	The first request of a key sends the message, the ones that arrive before its reply wait for it and
+	get a copy. Keys must hold everything the reply depends on: subject, payload and the user.
+
+	COALESCE: false to send every request. Default = true
+ */
+type Group struct {
+	Enabled 	bool
+
+	mu 		sync.Mutex
+	calls 		map[string]*call
+
+	requests 	uint64
+	coalesced 	uint64
+}
+
+// call is a request in flight
+type call struct {
+	done 		chan struct{}
+	reply 		models.Reply
+	err 		error
+}
+
+// errPanicked is the error of the requests that waited for a round trip that panicked
+var errPanicked = errors.New("coalesce: the shared request failed")
+
+// Stats counts the requests that went through the group
+type Stats struct {
+	Requests 	uint64 		`json:"requests"`		// requests sent or coalesced
+	Coalesced 	uint64 		`json:"coalesced"`		// requests answered with the reply of another one
+	InFlight 	int 		`json:"in_flight"`		// round trips waiting for a reply
+}
+
+// New creates an enabled group
+func New() *Group {
+	return &Group{Enabled: true, calls: map[string]*call{}}
+}
+
+// FromEnv creates the group from COALESCE
+func FromEnv() *Group {
+	g := New()
+	g.Enabled = os.Getenv("COALESCE") != "false"
+	return g
+}
+
+/*
+	Do runs send once for every key in flight and returns its reply to every caller.
+	Shared reports whether the reply came from the round trip of another request.
+	Each caller gets its own headers, the body is shared and must not be modified.
+ */
+func (g *Group) Do(key string, send func() (models.Reply, error)) (reply models.Reply, shared bool, err error) {
+
+	atomic.AddUint64(&g.requests, 1)
+
+	if g.Enabled == false {
+		reply, err = send()
+		return reply, false, err
+	}
+
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+
+		<-c.done
+		atomic.AddUint64(&g.coalesced, 1)
+		return copyReply(c.reply), true, c.err
+	}
+
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	// the key is released even when send panics, waiting requests get an error
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.err = errPanicked
+	c.reply, c.err = send()
+
+	return copyReply(c.reply), false, c.err
+}
+
+// Stats returns the counters of the group
+func (g *Group) Stats() Stats {
+
+	g.mu.Lock()
+	inFlight := len(g.calls)
+	g.mu.Unlock()
+
+	return Stats{
+		Requests: atomic.LoadUint64(&g.requests),
+		Coalesced: atomic.LoadUint64(&g.coalesced),
+		InFlight: inFlight,
+	}
+}
+
+func copyReply(reply models.Reply) models.Reply {
+	if reply.Headers != nil {
+		headers := make(map[string]string, len(reply.Headers))
+		for name, value := range reply.Headers {
+			headers[name] = value
+		}
+		reply.Headers = headers
+	}
+	return reply
+}
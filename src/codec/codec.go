@@ -0,0 +1,104 @@
+package codec
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/nats-io/nats.go"
+	"strconv"
+	"strings"
+	"errors"
+)
+
+// Content types of the gateway <-> service wire encodings
+const (
+	JSON = "application/json"
+	MessagePack = "application/msgpack"
+	Protobuf = "application/protobuf"
+)
+
+// ContentTypeHeader is the NATS message header that names the encoding of the message
+const ContentTypeHeader = "Content-Type"
+
+/*
+	Codec encodes the messages sent between the gateway and the micro services.
+
+	The encoding of a request is chosen per service and sent in the Content-Type header of the NATS message.
+	Services answer with a Reply envelope in the same encoding. The HTTP side always stays JSON.
+	Binary encodings always carry the version 2 message payload, see message.proto.
+ */
+type Codec interface {
+	ContentType() string
+	Marshal(payload models.MessagePayloadV2) ([]byte, error)
+	Unmarshal(data []byte) (models.MessagePayloadV2, error)
+	MarshalReply(reply models.Reply) ([]byte, error)
+	UnmarshalReply(data []byte) (models.Reply, error)
+}
+
+var codecs = map[string]Codec{
+	JSON: jsonCodec{},
+	MessagePack: msgpackCodec{},
+	Protobuf: protobufCodec{},
+}
+
+// names services use for their encoding in the registry
+var names = map[string]string{
+	"": JSON,
+	"json": JSON,
+	"msgpack": MessagePack,
+	"protobuf": Protobuf,
+}
+
+// ForName returns the codec of a registry encoding name: json (default), msgpack or protobuf
+func ForName(name string) (Codec, error) {
+	if contentType, ok := names[name]; ok {
+		return codecs[contentType], nil
+	}
+	return nil, errors.New("codec: unknown encoding: " + name)
+}
+
+// ForContentType returns the codec of a content type, parameters are ignored. ex: application/msgpack
+func ForContentType(contentType string) (Codec, bool) {
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	c, ok := codecs[strings.TrimSpace(contentType)]
+	return c, ok
+}
+
+/*
+	ReadReply decodes the reply of a service.
+
+	Binary replies are Reply envelopes in the encoding named by their Content-Type header.
+	JSON replies are the Response Object itself, as services have always sent it; their status and
+	headers can be sent as NATS headers (Status: 404). Nats- headers are never copied.
+ */
+func ReadReply(msg *nats.Msg) (models.Reply, error) {
+
+	contentType := ""
+	if msg.Header != nil {
+		contentType = msg.Header.Get(ContentTypeHeader)
+	}
+
+	if c, ok := ForContentType(contentType); ok && c.ContentType() != JSON {
+		return c.UnmarshalReply(msg.Data)
+	}
+
+	reply := models.Reply{Body: msg.Data}
+
+	for name, values := range msg.Header {
+		if len(values) == 0 || name == ContentTypeHeader || strings.HasPrefix(name, "Nats-") {
+			continue
+		}
+		if name == "Status" {
+			if status, err := strconv.Atoi(values[0]); err == nil {
+				reply.Status = status
+			}
+			continue
+		}
+		if reply.Headers == nil {
+			reply.Headers = map[string]string{}
+		}
+		reply.Headers[name] = values[0]
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,33 @@
+package codec
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"encoding/json"
+)
+
+// jsonCodec is the default encoding
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return JSON
+}
+
+func (jsonCodec) Marshal(payload models.MessagePayloadV2) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+func (jsonCodec) Unmarshal(data []byte) (models.MessagePayloadV2, error) {
+	var payload models.MessagePayloadV2
+	err := json.Unmarshal(data, &payload)
+	return payload, err
+}
+
+func (jsonCodec) MarshalReply(reply models.Reply) ([]byte, error) {
+	return json.Marshal(reply)
+}
+
+func (jsonCodec) UnmarshalReply(data []byte) (models.Reply, error) {
+	var reply models.Reply
+	err := json.Unmarshal(data, &reply)
+	return reply, err
+}
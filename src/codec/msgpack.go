@@ -0,0 +1,119 @@
+package codec
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/vmihailenco/msgpack/v5"
+	"encoding/json"
+)
+
+/*
+	msgpackCodec encodes messages with MessagePack.
+
+	The body is carried as bin holding the JSON document, like the bytes body of message.proto,
+	so the gateway never decodes and re-encodes it.
+ */
+type msgpackCodec struct{}
+
+type msgpackPayload struct {
+	SchemaVersion 	int 		`msgpack:"schema_version"`
+	Auid 		string 		`msgpack:"auid"`
+	Uuid 		string 		`msgpack:"uuid"`
+	Object 		string 		`msgpack:"object"`
+	Key 		string 		`msgpack:"key"`
+	Keyword 	string 		`msgpack:"keyword"`
+	Body 		[]byte 		`msgpack:"body,omitempty"`
+	Perspective 	string 		`msgpack:"perspective"`
+	Results 	int 		`msgpack:"results"`
+	Page 		int 		`msgpack:"page"`
+	Http_method 	string 		`msgpack:"http_method"`
+	Method 		string 		`msgpack:"method"`
+	Version 	string 		`msgpack:"version"`
+	Params 		map[string][]string `msgpack:"params,omitempty"`
+	Headers 	map[string]string `msgpack:"headers,omitempty"`
+	Query 		*models.Query `msgpack:"query,omitempty"`
+	Cursor 		string 		`msgpack:"cursor,omitempty"`
+}
+
+type msgpackReply struct {
+	Status 		int 			`msgpack:"status"`
+	Headers 	map[string]string 	`msgpack:"headers,omitempty"`
+	Body 		[]byte 			`msgpack:"body"`
+}
+
+func (msgpackCodec) ContentType() string {
+	return MessagePack
+}
+
+func (msgpackCodec) Marshal(payload models.MessagePayloadV2) ([]byte, error) {
+
+	return msgpack.Marshal(msgpackPayload{
+		SchemaVersion: payload.SchemaVersion,
+		Auid: payload.Auid,
+		Uuid: payload.Uuid,
+		Object: payload.Object,
+		Key: payload.Key,
+		Keyword: payload.Keyword,
+		Body: payload.Body,
+		Perspective: payload.Perspective,
+		Results: payload.Results,
+		Page: payload.Page,
+		Http_method: payload.Http_method,
+		Method: payload.Method,
+		Version: payload.Version,
+		Params: payload.Params,
+		Headers: payload.Headers,
+		Query: payload.Query,
+		Cursor: payload.Cursor,
+	})
+}
+
+func (msgpackCodec) Unmarshal(data []byte) (models.MessagePayloadV2, error) {
+
+	var wire msgpackPayload
+	if err := msgpack.Unmarshal(data, &wire); err != nil {
+		return models.MessagePayloadV2{}, err
+	}
+
+	return models.MessagePayloadV2{
+		SchemaVersion: wire.SchemaVersion,
+		Auid: wire.Auid,
+		Uuid: wire.Uuid,
+		Object: wire.Object,
+		Key: wire.Key,
+		Keyword: wire.Keyword,
+		Body: body(wire.Body),
+		Perspective: wire.Perspective,
+		Results: wire.Results,
+		Page: wire.Page,
+		Http_method: wire.Http_method,
+		Method: wire.Method,
+		Version: wire.Version,
+		Params: wire.Params,
+		Headers: wire.Headers,
+		Query: wire.Query,
+		Cursor: wire.Cursor,
+	}, nil
+}
+
+func (msgpackCodec) MarshalReply(reply models.Reply) ([]byte, error) {
+
+	return msgpack.Marshal(msgpackReply{Status: reply.Status, Headers: reply.Headers, Body: reply.Body})
+}
+
+func (msgpackCodec) UnmarshalReply(data []byte) (models.Reply, error) {
+
+	var wire msgpackReply
+	if err := msgpack.Unmarshal(data, &wire); err != nil {
+		return models.Reply{}, err
+	}
+
+	return models.Reply{Status: wire.Status, Headers: wire.Headers, Body: body(wire.Body)}, nil
+}
+
+// body returns the JSON document of a bin body, nil when the body is empty
+func body(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.RawMessage(data)
+}
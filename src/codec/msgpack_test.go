@@ -0,0 +1,58 @@
+package codec
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/vmihailenco/msgpack/v5"
+	"encoding/json"
+	"testing"
+)
+
+func TestMsgpackBodyIsCarriedAsBytes(t *testing.T) {
+
+	body := json.RawMessage(`{"b":1.50,"a":"x"}`)
+	data, err := msgpackCodec{}.Marshal(models.MessagePayloadV2{SchemaVersion: 2, Object: "person", Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wire map[string]interface{}
+	if err := msgpack.Unmarshal(data, &wire); err != nil {
+		t.Fatal(err)
+	}
+	if raw, ok := wire["body"].([]byte); !ok || string(raw) != string(body) {
+		t.Fatalf("body on the wire = %#v, want bin %s", wire["body"], body)
+	}
+
+	payload, err := msgpackCodec{}.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload.Body) != string(body) || payload.Object != "person" {
+		t.Fatalf("payload = %+v", payload)
+	}
+}
+
+func TestMsgpackReplyRoundTrip(t *testing.T) {
+
+	reply := models.Reply{Status: 201, Headers: map[string]string{"Location": "/person/1"}, Body: json.RawMessage(`[1,2]`)}
+	data, err := msgpackCodec{}.MarshalReply(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := msgpackCodec{}.UnmarshalReply(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != 201 || got.Headers["Location"] != "/person/1" || string(got.Body) != "[1,2]" {
+		t.Fatalf("reply = %+v", got)
+	}
+
+	empty, err := msgpackCodec{}.MarshalReply(models.Reply{Status: 204})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := (msgpackCodec{}).UnmarshalReply(empty); err != nil || got.Body != nil {
+		t.Fatalf("empty reply = %+v, %v", got, err)
+	}
+}
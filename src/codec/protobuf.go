@@ -0,0 +1,418 @@
+package codec
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"google.golang.org/protobuf/encoding/protowire"
+	"encoding/json"
+	"errors"
+)
+
+/*
+	protobufCodec encodes messages with Protocol Buffers, see message.proto for the published schema.
+
+	The messages are small and flat, so they are encoded with protowire directly instead of generated code.
+	Default values are not written, as proto3 does.
+ */
+type protobufCodec struct{}
+
+// field numbers of MessagePayload in message.proto
+const (
+	payloadSchemaVersion protowire.Number = iota + 1
+	payloadAuid
+	payloadUuid
+	payloadObject
+	payloadKey
+	payloadKeyword
+	payloadBody
+	payloadPerspective
+	payloadResults
+	payloadPage
+	payloadHttpMethod
+	payloadMethod
+	payloadVersion
+	payloadParams
+	payloadHeaders
+	payloadQuery
+	payloadCursor
+)
+
+// field numbers of Reply in message.proto
+const (
+	replyStatus protowire.Number = iota + 1
+	replyHeaders
+	replyBody
+)
+
+var errProtobuf = errors.New("codec: invalid protobuf message")
+
+func (protobufCodec) ContentType() string {
+	return Protobuf
+}
+
+func (protobufCodec) Marshal(payload models.MessagePayloadV2) ([]byte, error) {
+
+	var b []byte
+	b = appendInt(b, payloadSchemaVersion, payload.SchemaVersion)
+	b = appendString(b, payloadAuid, payload.Auid)
+	b = appendString(b, payloadUuid, payload.Uuid)
+	b = appendString(b, payloadObject, payload.Object)
+	b = appendString(b, payloadKey, payload.Key)
+	b = appendString(b, payloadKeyword, payload.Keyword)
+	b = appendBytes(b, payloadBody, payload.Body)
+	b = appendString(b, payloadPerspective, payload.Perspective)
+	b = appendInt(b, payloadResults, payload.Results)
+	b = appendInt(b, payloadPage, payload.Page)
+	b = appendString(b, payloadHttpMethod, payload.Http_method)
+	b = appendString(b, payloadMethod, payload.Method)
+	b = appendString(b, payloadVersion, payload.Version)
+	for name, values := range payload.Params {
+		// Param message: name = 1, values = 2
+		var param []byte
+		param = appendString(param, 1, name)
+		for _, value := range values {
+			param = protowire.AppendTag(param, 2, protowire.BytesType)
+			param = protowire.AppendString(param, value)
+		}
+		b = protowire.AppendTag(b, payloadParams, protowire.BytesType)
+		b = protowire.AppendBytes(b, param)
+	}
+	b = appendMap(b, payloadHeaders, payload.Headers)
+	if payload.Query != nil {
+		b = protowire.AppendTag(b, payloadQuery, protowire.BytesType)
+		b = protowire.AppendBytes(b, appendQuery(nil, payload.Query))
+	}
+	b = appendString(b, payloadCursor, payload.Cursor)
+
+	return b, nil
+}
+
+func (protobufCodec) Unmarshal(data []byte) (models.MessagePayloadV2, error) {
+
+	var payload models.MessagePayloadV2
+
+	err := consume(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType && num == payloadSchemaVersion:
+			return consumeInt(b, &payload.SchemaVersion)
+		case typ == protowire.VarintType && num == payloadResults:
+			return consumeInt(b, &payload.Results)
+		case typ == protowire.VarintType && num == payloadPage:
+			return consumeInt(b, &payload.Page)
+		case typ == protowire.BytesType && num == payloadBody:
+			v, n := protowire.ConsumeBytes(b)
+			if n >= 0 && len(v) > 0 {
+				payload.Body = append(json.RawMessage(nil), v...)
+			}
+			return n
+		case typ == protowire.BytesType && num == payloadParams:
+			param, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			var name string
+			var values []string
+			err := consume(param, func(num protowire.Number, typ protowire.Type, b []byte) int {
+				if typ == protowire.BytesType && (num == 1 || num == 2) {
+					v, n := protowire.ConsumeString(b)
+					if num == 1 {
+						name = v
+					} else {
+						values = append(values, v)
+					}
+					return n
+				}
+				return protowire.ConsumeFieldValue(num, typ, b)
+			})
+			if err != nil {
+				return -1
+			}
+			if payload.Params == nil {
+				payload.Params = map[string][]string{}
+			}
+			payload.Params[name] = append(payload.Params[name], values...)
+			return n
+		case typ == protowire.BytesType && num == payloadHeaders:
+			if payload.Headers == nil {
+				payload.Headers = map[string]string{}
+			}
+			return consumeMapEntry(b, payload.Headers)
+		case typ == protowire.BytesType && num == payloadQuery:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n
+			}
+			query, err := consumeQuery(v)
+			if err != nil {
+				return -1
+			}
+			payload.Query = query
+			return n
+		case typ == protowire.BytesType && payloadString(&payload, num) != nil:
+			v, n := protowire.ConsumeString(b)
+			*payloadString(&payload, num) = v
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+
+	return payload, err
+}
+
+func (protobufCodec) MarshalReply(reply models.Reply) ([]byte, error) {
+
+	var b []byte
+	b = appendInt(b, replyStatus, reply.Status)
+	b = appendMap(b, replyHeaders, reply.Headers)
+	b = appendBytes(b, replyBody, reply.Body)
+
+	return b, nil
+}
+
+func (protobufCodec) UnmarshalReply(data []byte) (models.Reply, error) {
+
+	var reply models.Reply
+
+	err := consume(data, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		switch {
+		case typ == protowire.VarintType && num == replyStatus:
+			return consumeInt(b, &reply.Status)
+		case typ == protowire.BytesType && num == replyBody:
+			v, n := protowire.ConsumeBytes(b)
+			if n >= 0 {
+				reply.Body = append(json.RawMessage(nil), v...)
+			}
+			return n
+		case typ == protowire.BytesType && num == replyHeaders:
+			if reply.Headers == nil {
+				reply.Headers = map[string]string{}
+			}
+			return consumeMapEntry(b, reply.Headers)
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+
+	return reply, err
+}
+
+// payloadString returns the string field of the payload with field number num
+func payloadString(payload *models.MessagePayloadV2, num protowire.Number) *string {
+	switch num {
+	case payloadAuid:
+		return &payload.Auid
+	case payloadUuid:
+		return &payload.Uuid
+	case payloadObject:
+		return &payload.Object
+	case payloadKey:
+		return &payload.Key
+	case payloadKeyword:
+		return &payload.Keyword
+	case payloadPerspective:
+		return &payload.Perspective
+	case payloadHttpMethod:
+		return &payload.Http_method
+	case payloadMethod:
+		return &payload.Method
+	case payloadVersion:
+		return &payload.Version
+	case payloadCursor:
+		return &payload.Cursor
+	}
+	return nil
+}
+
+// consume walks every field of a message; field returns the length of the value it consumed or < 0
+func consume(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) int) error {
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errProtobuf
+		}
+		b = b[n:]
+
+		n = field(num, typ, b)
+		if n < 0 {
+			return errProtobuf
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// appendQuery writes the Query message: filters = 1, sort = 2, fields = 3
+func appendQuery(b []byte, query *models.Query) []byte {
+
+	for _, filter := range query.Filters {
+		var f []byte
+		f = appendString(f, 1, filter.Field)
+		f = appendString(f, 2, filter.Operator)
+		f = appendString(f, 3, filter.Value)
+		for _, value := range filter.Values {
+			f = protowire.AppendTag(f, 4, protowire.BytesType)
+			f = protowire.AppendString(f, value)
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, f)
+	}
+
+	for _, sort := range query.Sort {
+		var f []byte
+		f = appendString(f, 1, sort.Field)
+		if sort.Descending {
+			f = protowire.AppendTag(f, 2, protowire.VarintType)
+			f = protowire.AppendVarint(f, 1)
+		}
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, f)
+	}
+
+	for _, field := range query.Fields {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, field)
+	}
+
+	return b
+}
+
+// consumeQuery reads the Query message
+func consumeQuery(b []byte) (*models.Query, error) {
+
+	query := &models.Query{}
+
+	err := consume(b, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if typ != protowire.BytesType {
+			return protowire.ConsumeFieldValue(num, typ, b)
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n
+		}
+
+		switch num {
+		case 1:
+			var filter models.Filter
+			err := consume(v, func(num protowire.Number, typ protowire.Type, b []byte) int {
+				if typ != protowire.BytesType {
+					return protowire.ConsumeFieldValue(num, typ, b)
+				}
+				s, n := protowire.ConsumeString(b)
+				switch num {
+				case 1:
+					filter.Field = s
+				case 2:
+					filter.Operator = s
+				case 3:
+					filter.Value = s
+				case 4:
+					filter.Values = append(filter.Values, s)
+				}
+				return n
+			})
+			if err != nil {
+				return -1
+			}
+			query.Filters = append(query.Filters, filter)
+		case 2:
+			var sort models.Sort
+			err := consume(v, func(num protowire.Number, typ protowire.Type, b []byte) int {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					s, n := protowire.ConsumeString(b)
+					sort.Field = s
+					return n
+				case num == 2 && typ == protowire.VarintType:
+					d, n := protowire.ConsumeVarint(b)
+					sort.Descending = d != 0
+					return n
+				}
+				return protowire.ConsumeFieldValue(num, typ, b)
+			})
+			if err != nil {
+				return -1
+			}
+			query.Sort = append(query.Sort, sort)
+		case 3:
+			query.Fields = append(query.Fields, string(v))
+		}
+
+		return n
+	})
+
+	return query, err
+}
+
+// consumeMapEntry adds one map<string, string> entry (key = 1, value = 2) to m
+func consumeMapEntry(b []byte, m map[string]string) int {
+
+	entry, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n
+	}
+
+	var name, value string
+	err := consume(entry, func(num protowire.Number, typ protowire.Type, b []byte) int {
+		if typ == protowire.BytesType && (num == 1 || num == 2) {
+			v, n := protowire.ConsumeString(b)
+			if num == 1 {
+				name = v
+			} else {
+				value = v
+			}
+			return n
+		}
+		return protowire.ConsumeFieldValue(num, typ, b)
+	})
+	if err != nil {
+		return -1
+	}
+
+	m[name] = value
+	return n
+}
+
+func consumeInt(b []byte, target *int) int {
+	v, n := protowire.ConsumeVarint(b)
+	if n >= 0 {
+		*target = int(int32(v))
+	}
+	return n
+}
+
+func appendInt(b []byte, num protowire.Number, v int) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(int64(int32(v))))
+}
+
+// appendMap writes a map<string, string> field, every entry is a message with key = 1 and value = 2
+func appendMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	for name, value := range m {
+		var entry []byte
+		entry = appendString(entry, 1, name)
+		entry = appendString(entry, 2, value)
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
@@ -0,0 +1,227 @@
+package composite
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"errors"
+	"sync"
+	"log"
+	"os"
+)
+
+/*
+	Composite is a route that joins the replies of several services into one JSON document.
+
+	Every step is a GET service call, a composite only reads. Params can use values of the request and of earlier steps with
+	{{request.<param>}} and {{<step>.<path>}} templates. ex: {"uuid": "{{person.account_uuid}}"}
+	A step that uses another step's values runs after it, independent steps run concurrently.
+
+	The document has one key per step, named after the step (or its "as"). Hidden steps are only used
+	for their values. ex: {"person": {...}, "account": {...}, "permissions": [...]}
+
+	on_error: fail (default) responds with the error of the first failed step.
+	partial responds with every step that succeeded, failed and skipped steps are null and listed under "errors".
+	Optional steps never fail the composite.
+
+	COMPOSITES_FILE: path to a JSON file with the list of composites
+ */
+type Composite struct {
+	Name 		string 	`json:"name"`			// route name, /composite/<name>
+	OnError 	string 	`json:"on_error,omitempty"`	// fail or partial
+	Steps 		[]Step 	`json:"steps"`
+}
+
+// Step is a single service call of a composite
+type Step struct {
+	Name 		string 			`json:"name"`			// key of the reply in the document and in templates
+	As 		string 			`json:"as,omitempty"`		// key of the reply in the document. Default = name
+	Method 		string 			`json:"method,omitempty"`	// HTTP method, only GET. Default = GET
+	Object 		string 			`json:"object"`
+	Op 		string 			`json:"op"`			// service method
+	Params 		map[string]string 	`json:"params,omitempty"`	// URL params, can use templates
+	DependsOn 	[]string 		`json:"depends_on,omitempty"`	// steps to wait for, on top of the ones used in templates
+	Optional 	bool 			`json:"optional,omitempty"`	// failure never fails the composite
+	Hidden 		bool 			`json:"hidden,omitempty"`	// not part of the document
+
+	deps 		[]int 			// indexes of the steps this step waits for
+}
+
+// Registry holds the configured composites by name
+type Registry struct {
+	mu 		sync.RWMutex
+	composites 	map[string]*Composite
+}
+
+// New creates an empty registry
+func New() *Registry {
+	return &Registry{composites: map[string]*Composite{}}
+}
+
+// FromEnv creates a registry and loads COMPOSITES_FILE
+func FromEnv() *Registry {
+
+	r := New()
+
+	if path := os.Getenv("COMPOSITES_FILE"); path != "" {
+		if err := r.LoadFile(path); err != nil {
+			log.Println(">>> ERROR: COMPOSITES_FILE - ", err)
+		}
+	}
+
+	return r
+}
+
+// LoadFile registers every composite defined in a JSON file
+func (r *Registry) LoadFile(path string) error {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var composites []Composite
+	if err := json.Unmarshal(data, &composites); err != nil {
+		return err
+	}
+
+	for i := range composites {
+		if err := r.Register(&composites[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Register checks the composite and its step graph and adds it to the registry
+func (r *Registry) Register(c *Composite) error {
+
+	if err := c.plan(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.composites[c.Name] = c
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Lookup returns the composite registered with name
+func (r *Registry) Lookup(name string) (*Composite, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.composites[name]
+	return c, ok
+}
+
+/*
+	plan checks the steps and resolves their dependencies.
+
+	Step names must be unique and can't be request or errors (the key of the failed steps).
+	Steps are GETs, and the document keys (as, or the name) of the steps that are not hidden must be unique.
+	Templates and depends_on can only name other steps, and the dependencies can't form a cycle.
+ */
+func (c *Composite) plan() error {
+
+	if c.Name == "" {
+		return errors.New("composite: name is empty")
+	}
+	if len(c.Steps) == 0 {
+		return errors.New("composite " + c.Name + ": has no steps")
+	}
+	switch c.OnError {
+	case "", "fail", "partial":
+	default:
+		return errors.New("composite " + c.Name + ": on_error must be fail or partial")
+	}
+
+	index := map[string]int{}
+	keys := map[string]string{}
+	for i, step := range c.Steps {
+		if step.Name == "" || step.Name == "request" || step.Name == "errors" || step.As == "errors" {
+			return errors.New("composite " + c.Name + ": invalid step name " + step.Name)
+		}
+		if _, ok := index[step.Name]; ok {
+			return errors.New("composite " + c.Name + ": duplicate step " + step.Name)
+		}
+		if step.Object == "" {
+			return errors.New("composite " + c.Name + ": step " + step.Name + " has no object")
+		}
+		if step.Method != "" && strings.ToUpper(step.Method) != "GET" {
+			return errors.New("composite " + c.Name + ": step " + step.Name + " must be a GET, composites only read")
+		}
+		index[step.Name] = i
+
+		// two steps with the same key would overwrite each other in the document
+		if step.Hidden {
+			continue
+		}
+		key := step.As
+		if key == "" {
+			key = step.Name
+		}
+		if other, ok := keys[key]; ok {
+			return errors.New("composite " + c.Name + ": steps " + other + " and " + step.Name + " both use the key " + key)
+		}
+		keys[key] = step.Name
+	}
+
+	for i := range c.Steps {
+		step := &c.Steps[i]
+
+		names := append([]string{}, step.DependsOn...)
+		for _, value := range step.Params {
+			for _, ref := range references(value) {
+				if ref.step != "request" {
+					names = append(names, ref.step)
+				}
+			}
+		}
+
+		seen := map[int]bool{}
+		step.deps = nil
+		for _, name := range names {
+			j, ok := index[name]
+			if !ok {
+				return errors.New("composite " + c.Name + ": step " + step.Name + " uses unknown step " + name)
+			}
+			if j == i {
+				return errors.New("composite " + c.Name + ": step " + step.Name + " uses itself")
+			}
+			if !seen[j] {
+				seen[j] = true
+				step.deps = append(step.deps, j)
+			}
+		}
+	}
+
+	// depth first search for cycles
+	state := make([]int, len(c.Steps)) // 0 = new, 1 = visiting, 2 = done
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return errors.New("composite " + c.Name + ": dependency cycle at step " + c.Steps[i].Name)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, j := range c.Steps[i].deps {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		state[i] = 2
+		return nil
+	}
+	for i := range c.Steps {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package composite
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRegisterRejectsInvalidSteps(t *testing.T) {
+
+	tests := map[string][]Step{
+		"write step": {{Name: "person", Object: "person", Op: "create", Method: "POST"}},
+		"same key": {{Name: "person", Object: "person", Op: "get"}, {Name: "other", As: "person", Object: "person", Op: "get"}},
+		"same as": {{Name: "a", As: "x", Object: "person", Op: "get"}, {Name: "b", As: "x", Object: "account", Op: "get"}},
+		"cycle": {{Name: "a", Object: "person", Op: "get", DependsOn: []string{"b"}}, {Name: "b", Object: "person", Op: "get", DependsOn: []string{"a"}}},
+	}
+
+	for name, steps := range tests {
+		if err := New().Register(&Composite{Name: "c", Steps: steps}); err == nil {
+			t.Errorf("%s: composite was registered", name)
+		}
+	}
+}
+
+func TestRegisterAcceptsHiddenStepsWithTheSameKey(t *testing.T) {
+
+	steps := []Step{
+		{Name: "person", Object: "person", Op: "get", Method: "get"},
+		{Name: "lookup", As: "person", Object: "person", Op: "find", Hidden: true},
+	}
+
+	if err := New().Register(&Composite{Name: "c", Steps: steps}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunResolvesTemplates(t *testing.T) {
+
+	c := &Composite{Name: "profile", Steps: []Step{
+		{Name: "person", Object: "person", Op: "get", Params: map[string]string{"uuid": "{{request.uuid}}"}},
+		{Name: "account", Object: "account", Op: "get", Params: map[string]string{"uuid": "{{person.account_uuid}}"}},
+	}}
+	if err := New().Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	response := c.Run(url.Values{"uuid": {"p1"}}, func(step Step, params url.Values) Outcome {
+		switch step.Name {
+		case "person":
+			return Outcome{Body: json.RawMessage(`{"uuid": "` + params.Get("uuid") + `", "account_uuid": "a1"}`)}
+		default:
+			return Outcome{Body: json.RawMessage(`{"uuid": "` + params.Get("uuid") + `"}`)}
+		}
+	})
+
+	if response.Status != 200 || !strings.Contains(string(response.Body), `"account":{"uuid":"a1"}`) {
+		t.Fatalf("response = %d %s", response.Status, response.Body)
+	}
+}
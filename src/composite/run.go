@@ -0,0 +1,135 @@
+package composite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// Dispatch sends the call of a step to its micro service
+type Dispatch func(step Step, params url.Values) Outcome
+
+// Outcome is the reply of a step
+type Outcome struct {
+	Status 	int 		`json:"status"`
+	Body 	json.RawMessage `json:"-"`
+	Error 	string 		`json:"error,omitempty"`
+}
+
+func (o Outcome) failed() bool {
+	return o.Status >= 400
+}
+
+/*
+	Response is the merged document of a composite request.
+
+	Status is 200 unless the composite failed, then it is the status of the first failed step
+	(in the order of the steps) and Body is {"error": ..., "step": ...}.
+ */
+type Response struct {
+	Status 	int
+	Body 	json.RawMessage
+}
+
+/*
+	Run executes the steps of the composite and merges their replies.
+
+	Each step runs in its own goroutine as soon as the steps it depends on are done. A step is skipped (424)
+	when a step it depends on failed or a template value is missing.
+ */
+func (c *Composite) Run(request url.Values, dispatch Dispatch) Response {
+
+	outcomes := make([]Outcome, len(c.Steps))
+	values := make([]interface{}, len(c.Steps))
+	done := make([]chan struct{}, len(c.Steps))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	for i := range c.Steps {
+		go func(i int) {
+			defer close(done[i])
+			step := c.Steps[i]
+
+			// wait for the dependencies; results written before close are visible after the receive
+			replies := map[string]interface{}{}
+			for _, j := range step.deps {
+				<-done[j]
+				if outcomes[j].failed() {
+					outcomes[i] = Outcome{Status: http.StatusFailedDependency, Error: "skipped, step " + c.Steps[j].Name + " failed"}
+					return
+				}
+				replies[c.Steps[j].Name] = values[j]
+			}
+
+			params := url.Values{}
+			for name, value := range step.Params {
+				resolved, ok := resolve(value, request, replies)
+				if !ok {
+					outcomes[i] = Outcome{Status: http.StatusFailedDependency, Error: "skipped, no value for param " + name}
+					return
+				}
+				params.Set(name, resolved)
+			}
+
+			outcomes[i] = dispatch(step, params)
+			if outcomes[i].Status == 0 {
+				outcomes[i].Status = http.StatusOK
+			}
+			if outcomes[i].failed() && outcomes[i].Error == "" {
+				outcomes[i].Error = http.StatusText(outcomes[i].Status)
+			}
+			if len(outcomes[i].Body) > 0 {
+				json.Unmarshal(outcomes[i].Body, &values[i])
+			}
+		}(i)
+	}
+
+	for i := range done {
+		<-done[i]
+	}
+
+	return c.merge(outcomes)
+}
+
+// merge builds the document, or the error of the first failed step when the composite fails
+func (c *Composite) merge(outcomes []Outcome) Response {
+
+	document := map[string]json.RawMessage{}
+	errs := map[string]Outcome{}
+
+	for i, step := range c.Steps {
+		outcome := outcomes[i]
+
+		if outcome.failed() {
+			if c.OnError != "partial" && step.Optional == false {
+				out, _ := json.Marshal(map[string]interface{}{"error": outcome.Error, "status": outcome.Status, "step": step.Name})
+				return Response{Status: outcome.Status, Body: out}
+			}
+			errs[step.Name] = outcome
+		}
+
+		if step.Hidden {
+			continue
+		}
+
+		key := step.As
+		if key == "" {
+			key = step.Name
+		}
+
+		if outcome.failed() || len(outcome.Body) == 0 || json.Valid(outcome.Body) == false {
+			document[key] = json.RawMessage("null")
+		} else {
+			document[key] = outcome.Body
+		}
+	}
+
+	if len(errs) > 0 {
+		out, _ := json.Marshal(errs)
+		document["errors"] = out
+	}
+
+	out, _ := json.Marshal(document)
+	return Response{Status: http.StatusOK, Body: out}
+}
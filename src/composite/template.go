@@ -0,0 +1,122 @@
+package composite
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// reference is a {{<step>.<path>}} template in a param value
+type reference struct {
+	raw 	string 		// the template, braces included
+	step 	string 		// step name or request
+	path 	[]string 	// field names and list indexes. ex: roles.0.name
+}
+
+// references returns the templates of a param value
+func references(value string) []reference {
+
+	var refs []reference
+
+	for {
+		start := strings.Index(value, "{{")
+		if start < 0 {
+			return refs
+		}
+		end := strings.Index(value[start:], "}}")
+		if end < 0 {
+			return refs
+		}
+
+		raw := value[start : start+end+2]
+		parts := strings.Split(strings.TrimSpace(raw[2:len(raw)-2]), ".")
+		refs = append(refs, reference{raw: raw, step: parts[0], path: parts[1:]})
+
+		value = value[start+end+2:]
+	}
+}
+
+/*
+	resolve replaces the templates of a param value.
+
+	request.<param> is the URL param of the composite request. <step>.<path> is a field of the step reply,
+	strings and numbers are used as is, lists of them are comma separated (for filter[<field>][in]=),
+	other values as JSON. ok is false when a referenced field is missing or null.
+ */
+func resolve(value string, request url.Values, replies map[string]interface{}) (string, bool) {
+
+	for _, ref := range references(value) {
+
+		var resolved string
+		if ref.step == "request" {
+			if len(ref.path) != 1 || request.Get(ref.path[0]) == "" {
+				return "", false
+			}
+			resolved = request.Get(ref.path[0])
+		} else {
+			field, found := lookup(replies[ref.step], ref.path)
+			if found == false || field == nil {
+				return "", false
+			}
+			resolved = format(field)
+		}
+
+		value = strings.Replace(value, ref.raw, resolved, 1)
+	}
+
+	return value, true
+}
+
+// lookup walks the path through objects and lists of a decoded reply
+func lookup(value interface{}, path []string) (interface{}, bool) {
+
+	for _, name := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			field, ok := v[name]
+			if !ok {
+				return nil, false
+			}
+			value = field
+		case []interface{}:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// format a reply field as a param value
+func format(value interface{}) string {
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case string, float64, bool:
+				items = append(items, format(item))
+			default:
+				out, _ := json.Marshal(v)
+				return string(out)
+			}
+		}
+		return strings.Join(items, ",")
+	}
+
+	out, _ := json.Marshal(value)
+	return string(out)
+}
@@ -0,0 +1,171 @@
+package compress
+
+import (
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"log"
+	"io"
+	"os"
+)
+
+/*
+	Compressor compresses responses with the encoding negotiated from Accept-Encoding.
+
+	Only responses of an allowed Content-Type that reach MinSize are compressed, smaller bodies
+	cost more to compress than they save. Responses that already have a Content-Encoding, HEAD requests
+	and WebSocket upgrades are left alone. Flushed responses (streams) are compressed chunk by chunk.
+
+	COMPRESS_ENCODINGS: encodings in order of preference. Default = zstd,br,gzip
+	COMPRESS_MIN_SIZE: smallest body in bytes that is compressed. Default = 1024
+	COMPRESS_TYPES: comma separated Content-Types that are compressed. Default = JSON, NDJSON, CSV, XML, YAML and text
+ */
+type Compressor struct {
+	Encodings 	[]string
+	MinSize 	int
+	Types 		[]string
+}
+
+// DefaultTypes are the Content-Types compressed when COMPRESS_TYPES isn't set
+var DefaultTypes = []string{
+	"application/json", "application/x-ndjson", "application/xml", "application/yaml",
+	"text/csv", "text/xml", "text/plain", "text/html",
+}
+
+// encoders keeps a pool of writers for every supported encoding, they are expensive to create
+var encoders = map[string]*sync.Pool{
+	"gzip": {New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}},
+	"br": {New: func() interface{} {
+		return brotli.NewWriterLevel(nil, 5)
+	}},
+	"zstd": {New: func() interface{} {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		return w
+	}},
+}
+
+// encoder is the part of the gzip, brotli and zstd writers the response writer uses
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+	Reset(w io.Writer)
+}
+
+// New creates the compressor with the default types
+func New(encodings []string, minSize int) *Compressor {
+	return &Compressor{Encodings: encodings, MinSize: minSize, Types: DefaultTypes}
+}
+
+// FromEnv creates the compressor from the COMPRESS_* variables
+func FromEnv() *Compressor {
+
+	c := New([]string{"zstd", "br", "gzip"}, 1024)
+
+	if val := os.Getenv("COMPRESS_ENCODINGS"); val != "" {
+		c.Encodings = nil
+		for _, name := range strings.Split(val, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, ok := encoders[name]; !ok {
+				log.Println(">>> ERROR: COMPRESS_ENCODINGS unknown encoding " + name)
+				continue
+			}
+			c.Encodings = append(c.Encodings, name)
+		}
+	}
+	if val := os.Getenv("COMPRESS_MIN_SIZE"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			c.MinSize = n
+		} else {
+			log.Println(">>> ERROR: COMPRESS_MIN_SIZE is not a size")
+		}
+	}
+	if val := os.Getenv("COMPRESS_TYPES"); val != "" {
+		c.Types = nil
+		for _, t := range strings.Split(val, ",") {
+			if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+				c.Types = append(c.Types, t)
+			}
+		}
+	}
+
+	return c
+}
+
+// Handler compresses the responses of next
+func (c *Compressor) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method == "HEAD" || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		encoding := c.Negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			// responses still vary with Accept-Encoding for caches
+			next.ServeHTTP(&varyWriter{ResponseWriter: w, c: c}, r)
+			return
+		}
+
+		cw := &responseWriter{ResponseWriter: w, c: c, encoding: encoding, status: http.StatusOK}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+/*
+	Negotiate picks the encoding of a response from Accept-Encoding: the highest q-value,
+	then the order of Encodings. Returns "" when the response isn't compressed.
+ */
+func (c *Compressor) Negotiate(accept string) string {
+
+	best, bestQ := "", 0.0
+	for _, encoding := range c.Encodings {
+		q, specific := 0.0, false
+		for _, entry := range strings.Split(accept, ",") {
+			params := strings.Split(entry, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			if name != encoding && (name != "*" || specific) {
+				continue
+			}
+
+			entryQ := 1.0
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+						entryQ = v
+					}
+				}
+			}
+			// the encoding named exactly wins over *
+			q, specific = entryQ, name == encoding
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// compresses reports whether responses of the Content-Type are compressed
+func (c *Compressor) compresses(contentType string) bool {
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	for _, t := range c.Types {
+		if t == mediaType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package compress
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"errors"
+	"io"
+)
+
+// ErrEncoding is returned by RequestBody for a Content-Encoding it can't decode
+var ErrEncoding = errors.New("compress: unsupported Content-Encoding, use gzip")
+
+/*
+	RequestBody returns the body of the request, decompressed when it was sent with Content-Encoding: gzip,
+	reading at most limit bytes. The limit applies after decompression so a small body can't expand into a zip bomb.
+ */
+func RequestBody(r *http.Request, limit int64) (io.Reader, error) {
+
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return io.LimitReader(r.Body, limit), nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return io.LimitReader(zr, limit), nil
+	}
+
+	return nil, ErrEncoding
+}
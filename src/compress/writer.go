@@ -0,0 +1,172 @@
+package compress
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+/*
+	responseWriter holds the start of the body until it knows whether to compress it:
+	once MinSize bytes were written, the handler flushed or the handler returned.
+ */
+type responseWriter struct {
+	http.ResponseWriter
+	c 		*Compressor
+	encoding 	string
+	status 		int
+	wroteHeader 	bool
+	decided 	bool
+	enc 		encoder
+	buf 		[]byte
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+
+	if w.wroteHeader || status < 200 {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+
+	// responses without a body are never compressed
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.c.MinSize {
+		w.decide(true)
+	}
+	return len(p), nil
+}
+
+// Flush sends what was written so far, a flushed response is compressed whatever its size
+func (w *responseWriter) Flush() {
+
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.decide(true)
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController the original writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the header, compressed when the body is large enough and of an allowed type, and the held bytes
+func (w *responseWriter) decide(large bool) {
+
+	w.decided = true
+
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	if h.Get("Content-Encoding") == "" && w.c.compresses(h.Get("Content-Type")) {
+		h.Add("Vary", "Accept-Encoding")
+
+		if large {
+			h.Del("Content-Length")
+			h.Set("Content-Encoding", w.encoding)
+			// the compressed body is a different representation, a strong ETag no longer holds
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Set("ETag", "W/" + etag)
+			}
+
+			w.enc = encoders[w.encoding].Get().(encoder)
+			w.enc.Reset(w.ResponseWriter)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if len(w.buf) > 0 {
+		if w.enc != nil {
+			w.enc.Write(w.buf)
+		} else {
+			w.ResponseWriter.Write(w.buf)
+		}
+	}
+	w.buf = nil
+}
+
+// close writes a body that stayed under MinSize and ends the compressed stream
+func (w *responseWriter) close() {
+
+	if !w.decided {
+		if !w.wroteHeader {
+			// nothing was written, the server answers 200 with an empty body
+			return
+		}
+		w.decide(false)
+	}
+
+	if w.enc != nil {
+		w.enc.Close()
+		w.enc.Reset(ioutil.Discard)
+		encoders[w.encoding].Put(w.enc)
+		w.enc = nil
+	}
+}
+
+// varyWriter adds Vary: Accept-Encoding to uncompressed responses that could have been compressed
+type varyWriter struct {
+	http.ResponseWriter
+	c 		*Compressor
+	wroteHeader 	bool
+}
+
+func (w *varyWriter) WriteHeader(status int) {
+
+	if !w.wroteHeader && status >= 200 {
+		w.wroteHeader = true
+		if w.c.compresses(w.Header().Get("Content-Type")) {
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *varyWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *varyWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *varyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
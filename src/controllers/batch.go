@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/julienschmidt/httprouter"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"log"
+	"os"
+)
+
+var (
+	// batchMaxItems is the maximum number of calls in a batch. Configured with BATCH_MAX_ITEMS
+	batchMaxItems = envInt("BATCH_MAX_ITEMS", 50)
+
+	// batchParallelism is the maximum number of calls of a batch in flight. Configured with BATCH_PARALLELISM
+	batchParallelism = envInt("BATCH_PARALLELISM", 8)
+)
+
+/*
+	This is the BATCH Controller. Runs several service calls in one HTTP request.
+
+	URL: /batch
+	Body: list of calls [{"method": "GET", "object": "person", "op": "get", "params": {"uuid": "1234"}, "body": {...}}, ...]
+	PATCH calls are JSON Patch when the body is a list, or send "content_type": "application/merge-patch+json";
+	writes of durable objects can send "idempotency_key"
+	Params: <batch?sequential=true> runs the calls in order and stops at the first call that fails (status >= 400)
+
+	The request is authenticated once. Calls run concurrently (BATCH_PARALLELISM at a time) unless sequential.
+	Responds with a list of results in the order of the calls: [{"status": 200, "body": {...}}, ...]
+	Bodies that are not JSON are sent as a JSON string.
+	Calls skipped after a failure in sequential mode get status 424.
+ */
+func (uc MainController) BatchController(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	user, valid := auth.VerifyKey(r.Header)
+	if valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// Read body, check valid JSON, process errors and ensure body size isn't larger than 1M after gzip decompression
+	reader, readable := requestBody(w, r)
+	if readable == false {
+		return
+	}
+	var calls []Call
+	err := json.NewDecoder(reader).Decode(&calls)
+	if err != nil {
+		log.Println(">>> ERROR: JSON Decoder error - ", err)
+
+		// Set HTTP Response Method
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close() // close body, can cause memory leaks
+
+	if len(calls) == 0 || len(calls) > batchMaxItems {
+		http.Error(w, "batch must have between 1 and " + strconv.Itoa(batchMaxItems) + " calls", http.StatusBadRequest)
+		return
+	}
+
+	var results []Result
+	if r.URL.Query().Get("sequential") == "true" {
+		results = sequential(user, r.Header, calls)
+	} else {
+		results = concurrent(user, r.Header, calls, batchParallelism)
+	}
+
+	writeBatch(w, results)
+}
+
+// writeBatch responds with the results; bodies that aren't JSON (plain text errors, binary replies) are sent as a string
+func writeBatch(w http.ResponseWriter, results []Result) {
+
+	for i := range results {
+		if len(results[i].Body) > 0 && !json.Valid(results[i].Body) {
+			results[i].Body, _ = json.Marshal(string(results[i].Body))
+		}
+	}
+
+	out, err := json.Marshal(results)
+	if err != nil {
+		log.Println(">>> ERROR: JSON Marshal error - ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Set Response Header
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	w.Write(out)
+}
+
+// sequential runs the calls in order and skips every call after the first failure
+func sequential(user *models.User, header http.Header, calls []Call) []Result {
+
+	results := make([]Result, len(calls))
+
+	for i, c := range calls {
+		results[i] = dispatch(user, header, c)
+
+		if results[i].Status >= 400 {
+			for j := i + 1; j < len(calls); j++ {
+				results[j] = failed(http.StatusFailedDependency, "skipped, call " + strconv.Itoa(i) + " failed")
+			}
+			break
+		}
+	}
+
+	return results
+}
+
+// concurrent runs the calls with at most parallelism calls in flight
+func concurrent(user *models.User, header http.Header, calls []Call, parallelism int) []Result {
+
+	results := make([]Result, len(calls))
+	slots := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	for i, c := range calls {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(i int, c Call) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			results[i] = dispatch(user, header, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// envInt reads a positive number from the environment
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/registry"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/nats-io/nats.go"
+	"net/http/httptest"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"os"
+)
+
+// responder answers every request on the subject with reply, on the server of NATS_URI
+func responder(t *testing.T, subject string, reply func(msg *nats.Msg) *nats.Msg) {
+
+	nc, err := nats.Connect(os.Getenv("NATS_URI"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	if _, err := nc.Subscribe(subject, func(msg *nats.Msg) { msg.RespondMsg(reply(msg)) }); err != nil {
+		t.Fatal(err)
+	}
+	nc.Flush()
+}
+
+func TestBatchNonJSONReplyNATS(t *testing.T) {
+
+	jetStream(t)
+	for _, service := range []registry.Service{{Object: "note"}, {Object: "label"}} {
+		if err := services.Register(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	responder(t, "note", func(*nats.Msg) *nats.Msg {
+		return &nats.Msg{Data: []byte(`{"text": "hi"}`)}
+	})
+	responder(t, "label", func(*nats.Msg) *nats.Msg {
+		msg := &nats.Msg{Header: nats.Header{}, Data: []byte("label service is read only\n")}
+		msg.Header.Set("Status", "403")
+		return msg
+	})
+
+	calls := []Call{{Method: "GET", Object: "note", Op: "get"}, {Method: "POST", Object: "label", Op: "create", Body: json.RawMessage(`{}`)}}
+	w := httptest.NewRecorder()
+	writeBatch(w, concurrent(&models.User{Auid: "u1"}, http.Header{}, calls, 2))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("batch status = %d %s", w.Code, w.Body)
+	}
+	var results []struct {
+		Status 	int
+		Body 	interface{}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Status != 200 || results[1].Status != 403 {
+		t.Fatalf("results = %s", w.Body)
+	}
+	if results[1].Body != "label service is read only\n" {
+		t.Fatalf("non-JSON body = %#v, want it as a string", results[1].Body)
+	}
+	if text := results[0].Body.(map[string]interface{})["text"]; text != "hi" {
+		t.Fatalf("JSON body = %#v", results[0].Body)
+	}
+}
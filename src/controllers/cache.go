@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/registry"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/cache"
+	"net/url"
+)
+
+// replies caches GET replies, dropped on the change events of their object and after writes to it. Configured with CACHE_TTL and CACHE_RULES
+var replies = cache.FromEnv(hub)
+
+/*
+	CachedSend answers a GET from the cache while the reply is fresh, otherwise it sends the request
+	and caches the reply when the service allows it. Objects without a TTL always reach the service.
+	Identical requests in flight share one round trip, see coalescedSend.
+ */
+func cachedSend(service *registry.Service, method string, q url.Values, auid string, headers map[string]string, contentType string, message []byte) (models.Reply, error) {
+
+	if replies.Enabled(service.Object) == false {
+		return coalescedSend(service.Subject, method, auid, contentType, message)
+	}
+
+	key := cache.Key(service.Subject, method, q, auid, headers)
+	if reply, hit := replies.Get(key); hit {
+		return reply, nil
+	}
+
+	// read before sending, a change during the request keeps the reply out of the cache
+	generation := replies.Generation(service.Object)
+
+	reply, err := coalescedSend(service.Subject, method, auid, contentType, message)
+	if err != nil {
+		return reply, err
+	}
+
+	return replies.Put(key, service.Object, generation, reply), nil
+}
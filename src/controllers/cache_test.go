@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/registry"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nats-io/nats.go"
+	"net/http/httptest"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConditionalGetFromCacheNATS(t *testing.T) {
+
+	jetStream(t)
+	if err := services.Register(registry.Service{Object: "article"}); err != nil {
+		t.Fatal(err)
+	}
+	replies.Rules["article"] = time.Minute
+	defer delete(replies.Rules, "article")
+
+	var calls int32
+	responder(t, "article", func(*nats.Msg) *nats.Msg {
+		atomic.AddInt32(&calls, 1)
+		return &nats.Msg{Data: []byte(`{"title": "Hello"}`)}
+	})
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/service/article/get?uuid=1", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		serve(w, r, &models.User{Auid: "u1"}, httprouter.Params{{Key: "object", Value: "article"}, {Key: "method", Value: "get"}})
+		return w
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first GET = %d, ETag %q", first.Code, etag)
+	}
+
+	second := get(etag)
+	if second.Code != http.StatusNotModified || second.Body.Len() != 0 {
+		t.Fatalf("conditional GET = %d %s, want 304", second.Code, second.Body)
+	}
+	if second.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("conditional GET was not answered from the cache: %v", second.Header())
+	}
+
+	if third := get(`"other"`); third.Code != http.StatusOK || third.Body.String() != `{"title": "Hello"}` {
+		t.Fatalf("GET with a stale validator = %d %s", third.Code, third.Body)
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("the service was called %d times, want 1", n)
+	}
+}
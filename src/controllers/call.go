@@ -0,0 +1,307 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/registry"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/schema"
+	"github.com/stevenmahana/ApiMainTemplate/src/durable"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"log"
+)
+
+/*
+	Call is a single service request. Every generic route runs its HTTP request as a call, and so do
+	the items of a batch, composite steps, GraphQL fields and WebSocket requests.
+
+	Every call goes through the same pipeline: registry lookup, query parsing, paging limits, schema validation,
+	payload encoding, then durable writes, async jobs, the response cache and coalescing, and shadowing.
+ */
+type Call struct {
+	Method 		string 		`json:"method"`				// HTTP method: GET, POST, PUT, PATCH, DELETE. Default = GET
+	Object 		string 		`json:"object"`				// object, as in /service/<object>/<method>
+	Op 		string 		`json:"op"`				// service method, as in /service/<object>/<method>
+	Params 		Params 		`json:"params,omitempty"`		// URL params. ex: {"uuid": "1234", "fields": "name,email"}
+	Body 		json.RawMessage `json:"body,omitempty"`			// request body of POST, PUT and PATCH
+	ContentType 	string 		`json:"content_type,omitempty"`		// PATCH format: application/json-patch+json or application/merge-patch+json. Default = JSON Patch for lists
+	IdempotencyKey 	string 		`json:"idempotency_key,omitempty"`	// writes of durable objects retried with the same key are stored once
+	Async 		bool 		`json:"-"`				// Prefer: respond-async of the HTTP request; calls ask with the async=true param
+}
+
+// Result is the outcome of a Call
+type Result struct {
+	Status 	int 			`json:"status"`
+	Headers map[string]string 	`json:"headers,omitempty"`
+	Body 	json.RawMessage 	`json:"body,omitempty"`
+	Error 	string 			`json:"error,omitempty"`
+}
+
+// Params are URL params. Values can be sent as a string or a list of strings
+type Params url.Values
+
+func (ps *Params) UnmarshalJSON(data []byte) error {
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*ps = Params{}
+	for name, value := range raw {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				(*ps)[name] = append((*ps)[name], scalar(item))
+			}
+		default:
+			(*ps)[name] = []string{scalar(v)}
+		}
+	}
+
+	return nil
+}
+
+// scalar formats a JSON value as a URL param value
+func scalar(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	out, _ := json.Marshal(value)
+	return string(out)
+}
+
+// failed builds the Result of a call that didn't reach the service
+func failed(status int, message string) Result {
+	return Result{Status: status, Error: message}
+}
+
+// prepared is a call that passed the checks of the pipeline, encoded in the wire format of its service
+type prepared struct {
+	Call
+	service 	*registry.Service
+	q 		url.Values
+	payload 	models.MessagePayload
+	contentType 	string
+	message 	[]byte
+}
+
+/*
+	Dispatch a call to its micro service on behalf of an authorized user.
+
+	header is the HTTP request the call came with, its allow listed headers are forwarded.
+	Streamed replies can only be piped to an HTTP response, calls of streaming methods are rejected.
+ */
+func dispatch(user *models.User, header http.Header, c Call) Result {
+
+	call, result := prepare(user, header, c)
+	if call == nil {
+		return result
+	}
+
+	// streamed replies can only be piped to an HTTP response
+	if call.service.Streams(call.Op) {
+		return failed(http.StatusBadRequest, call.Op + " streams its reply, use GET /service/" + call.Object + "/" + call.Op)
+	}
+
+	return call.run(user)
+}
+
+/*
+	Prepare checks the call and encodes its payload. Returns nil and the Result to answer with when the call fails a check.
+
+	The object must be a registered micro service that accepts the method, the params must parse and
+	bodies must be valid JSON that passes the schema of object/method/version.
+ */
+func prepare(user *models.User, header http.Header, c Call) (*prepared, Result) {
+
+	c.Method = strings.ToUpper(c.Method)
+	if c.Method == "" {
+		c.Method = "GET"
+	}
+	switch c.Method {
+	case "GET", "POST", "PUT", "PATCH", "DELETE":
+	default:
+		return nil, failed(http.StatusMethodNotAllowed, "unsupported method " + c.Method)
+	}
+
+	// object must be a registered micro service that accepts the method
+	service, found := services.Lookup(c.Object)
+	if found == false {
+		return nil, failed(http.StatusNotFound, "unknown object " + c.Object)
+	}
+	if service.Allows(c.Method) == false {
+		result := failed(http.StatusMethodNotAllowed, c.Object + " does not accept " + c.Method)
+		result.Headers = map[string]string{"Allow": strings.Join(service.Allow(), ", ")}
+		return nil, result
+	}
+
+	q := url.Values(c.Params)
+	if q == nil {
+		q = url.Values{}
+	}
+
+	// Parse filter, sort and field selection params; malformed queries are rejected
+	query, err := models.ParseQuery(q)
+	if err != nil {
+		return nil, failed(http.StatusBadRequest, err.Error())
+	}
+
+	// Enforce the maximum page size
+	if _, _, err := models.Paging(q.Get("results"), q.Get("page")); err != nil {
+		return nil, failed(http.StatusBadRequest, err.Error())
+	}
+
+	// Open cursor; cursors are only valid for the object and user they were issued for
+	marker, err := cursorMarker(q, service.Object, user.Auid)
+	if err != nil {
+		return nil, failed(http.StatusBadRequest, err.Error())
+	}
+
+	headers := forwarded(header)
+	if c.Method == "GET" {
+		for _, name := range conditionalHeaders {
+			delete(headers, name)
+		}
+	}
+
+	// validate body against the schema the service registered for object/method/version
+	body := ""
+	if c.Method == "POST" || c.Method == "PUT" || c.Method == "PATCH" {
+		var jbody interface{}
+		if err := json.Unmarshal(c.Body, &jbody); err != nil {
+			return nil, failed(http.StatusBadRequest, "body must be valid JSON")
+		}
+
+		// JSON Patch documents must be well formed; merge patches are validated like partial updates
+		var errs []schema.FieldError
+		if c.Method == "PATCH" {
+			c.ContentType = patchType(c.ContentType, jbody)
+			// service needs the patch format
+			headers["Content-Type"] = c.ContentType
+		}
+		if c.ContentType == jsonPatch && c.Method == "PATCH" {
+			errs = schema.ValidatePatch(jbody)
+		} else {
+			errs = schemas.Validate(service.Object, c.Op, q.Get("v"), c.Method, jbody)
+		}
+
+		if len(errs) > 0 {
+			out, _ := json.Marshal(map[string]interface{}{"error": http.StatusText(http.StatusUnprocessableEntity), "fields": errs})
+			return nil, Result{Status: http.StatusUnprocessableEntity, Body: out, Error: http.StatusText(http.StatusUnprocessableEntity)}
+		}
+
+		compact, _ := json.Marshal(jbody)
+		body = string(compact)
+	}
+
+	// Build Message Payload
+	payload := models.MessagePayload{
+		Auid: user.Auid,
+		Uuid: q.Get("uuid"),
+		Key: q.Get("key"),
+		Keyword: q.Get("keyword"),
+		Perspective: q.Get("perspective"),
+		Body: body,
+		Object: c.Object,
+		Method: c.Op,
+		Version: q.Get("v"),
+		Results: q.Get("results"),
+		Page: q.Get("page"),
+		Http_method: c.Method,
+		Params: q,
+		Headers: headers,
+		Query: query,
+		Cursor: marker,
+	}
+
+	// Encode payload in the version and wire encoding the service reads
+	message, contentType, err := encode(service, payload)
+	if err != nil {
+		return nil, failed(http.StatusBadRequest, err.Error())
+	}
+
+	return &prepared{Call: c, service: service, q: q, payload: payload, contentType: contentType, message: message}, Result{}
+}
+
+/*
+	Run sends the prepared call to its micro service.
+
+	Writes of durable objects are stored in JetStream and answered with 202 and a tracking ID, see persist.
+	Async calls (<method?async=true> or Prefer: respond-async) are answered with 202 and a job, see enqueue.
+	GETs are answered from the response cache while fresh and coalesced with identical GETs in flight, see cachedSend.
+	The request is mirrored to the shadow subject when one is configured.
+ */
+func (c *prepared) run(user *models.User) Result {
+
+	// Durable object; every write (POST, PUT, PATCH, DELETE) is stored in JetStream and answered with 202 and a tracking ID
+	if c.Method != "GET" && writes.Enabled(c.service) {
+		return persist(user, c.service.Object, c.Op, c.IdempotencyKey, durable.Digest(c.q, c.Body), c.contentType, c.message)
+	}
+
+	// Async request; answered with 202 and a job the client polls on /jobs/<id>
+	if c.Async || c.q.Get("async") == "true" {
+		return enqueue(user, c.service.Object, c.Op, c.service.Subject, c.contentType, c.message, c.Async)
+	}
+
+	var reply models.Reply
+	var err error
+	if c.Method == "GET" {
+		// Send Message; answered from the response cache while fresh, mirrored to the shadow subject when one is configured
+		reply, err = cachedSend(c.service, c.Op, c.q, user.Auid, c.payload.Headers, c.contentType, c.message)
+	} else {
+		// Send Message; mirrored to the shadow subject when one is configured
+		reply, err = send(c.service.Subject, c.Method, c.Op, c.contentType, c.message)
+	}
+	if err != nil {
+		log.Println(">>> ERROR: Service Connect Error - ", err)
+		return failed(http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+	}
+
+	// Cursor paging; links point at the generic route of the call
+	if c.Method == "GET" {
+		link := &url.URL{Path: "/service/" + c.Object + "/" + url.PathEscape(c.Op), RawQuery: c.q.Encode()}
+		paginate(link, c.service.Object, user.Auid, &reply)
+	}
+
+	status := reply.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	// a write changed the object; its cached replies are dropped now, not when its change event arrives
+	if c.Method != "GET" && status < 400 {
+		replies.Invalidate(c.service.Object)
+	}
+
+	return Result{Status: status, Headers: reply.Headers, Body: reply.Body}
+}
+
+// jsonPatch is the content type of JSON Patch (RFC 6902) documents
+const jsonPatch = "application/json-patch+json"
+
+/*
+	PatchType is the format of a PATCH body: the content type it was sent with, parameters are ignored.
+	Bodies sent without one are JSON Patch documents when they are a list, merge patches otherwise.
+ */
+func patchType(contentType string, body interface{}) string {
+
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+
+	switch contentType {
+	case jsonPatch, "application/merge-patch+json":
+		return contentType
+	}
+
+	if _, list := body.([]interface{}); list {
+		return jsonPatch
+	}
+	return "application/merge-patch+json"
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/registry"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/schema"
+	"github.com/julienschmidt/httprouter"
+	"net/http/httptest"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func registerPerson(t *testing.T) {
+
+	if err := services.Register(registry.Service{Object: "person"}); err != nil {
+		t.Fatal(err)
+	}
+	o, err := schema.ParseObject([]byte(`{"name": "person", "fields": [
+		{"name": "name", "type": "string", "required": true},
+		{"name": "email", "type": "string", "format": "email"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas.RegisterObject(o)
+}
+
+func TestPrepareJSONPatchCall(t *testing.T) {
+
+	registerPerson(t)
+	user := &models.User{Auid: "u1"}
+
+	c := Call{Method: "patch", Object: "person", Op: "update", Body: json.RawMessage(`[{"op": "replace", "path": "/name", "value": "Ann"}]`)}
+	call, result := prepare(user, http.Header{}, c)
+	if call == nil {
+		t.Fatalf("JSON Patch call failed: %+v %s", result, result.Body)
+	}
+	if got := call.payload.Headers["Content-Type"]; got != jsonPatch {
+		t.Fatalf("forwarded patch format = %q, want %q", got, jsonPatch)
+	}
+
+	c.Body = json.RawMessage(`[{"op": "rename", "path": "name"}]`)
+	if call, result := prepare(user, http.Header{}, c); call != nil || result.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("malformed JSON Patch status = %d, want 422", result.Status)
+	}
+}
+
+func TestPrepareMergePatchCall(t *testing.T) {
+
+	registerPerson(t)
+	user := &models.User{Auid: "u1"}
+
+	c := Call{Method: "PATCH", Object: "person", Op: "update", Body: json.RawMessage(`{"email": null}`)}
+	call, result := prepare(user, http.Header{}, c)
+	if call == nil {
+		t.Fatalf("merge patch call failed: %+v %s", result, result.Body)
+	}
+	if got := call.payload.Headers["Content-Type"]; got != "application/merge-patch+json" {
+		t.Fatalf("forwarded patch format = %q", got)
+	}
+
+	c.Body = json.RawMessage(`{"email": "nope"}`)
+	if call, result := prepare(user, http.Header{}, c); call != nil || result.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("invalid merge patch status = %d, want 422", result.Status)
+	}
+}
+
+func TestPrepareRejectsUnknownObjectAndMethod(t *testing.T) {
+
+	user := &models.User{Auid: "u1"}
+
+	if _, result := prepare(user, http.Header{}, Call{Object: "nobody", Op: "get"}); result.Status != http.StatusNotFound {
+		t.Fatalf("unknown object status = %d, want 404", result.Status)
+	}
+
+	registerPerson(t)
+	if _, result := prepare(user, http.Header{}, Call{Method: "TRACE", Object: "person", Op: "get"}); result.Status != http.StatusMethodNotAllowed {
+		t.Fatalf("TRACE status = %d, want 405", result.Status)
+	}
+}
+
+func TestPatchType(t *testing.T) {
+
+	tests := []struct {
+		contentType string
+		body interface{}
+		want string
+	}{
+		{"application/json-patch+json", map[string]interface{}{}, jsonPatch},
+		{"application/merge-patch+json; charset=utf-8", []interface{}{}, "application/merge-patch+json"},
+		{"application/json", []interface{}{}, jsonPatch},
+		{"", map[string]interface{}{}, "application/merge-patch+json"},
+	}
+
+	for _, test := range tests {
+		if got := patchType(test.contentType, test.body); got != test.want {
+			t.Errorf("patchType(%q) = %q, want %q", test.contentType, got, test.want)
+		}
+	}
+}
+
+func TestServeAnswersFailedChecks(t *testing.T) {
+
+	registerPerson(t)
+	user := &models.User{Auid: "u1"}
+	p := httprouter.Params{{Key: "object", Value: "person"}, {Key: "method", Value: "create"}}
+
+	w := httptest.NewRecorder()
+	serve(w, httptest.NewRequest("POST", "/service/person/create", strings.NewReader(`{"email": "ann@example.com"}`)), user, p)
+	if w.Code != http.StatusUnprocessableEntity || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("missing required field: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	w = httptest.NewRecorder()
+	serve(w, httptest.NewRequest("POST", "/service/person/create", strings.NewReader(`{"name": `)), user, p)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid JSON status = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/service/person/get", nil)
+	r.Header.Set("Accept", "image/png")
+	serve(w, r, user, p)
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("unacceptable format status = %d, want 406", w.Code)
+	}
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/coalesce"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/julienschmidt/httprouter"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// inflight shares the round trip of identical GETs in flight. Configured with COALESCE
+var inflight = coalesce.FromEnv()
+
+/*
+	CoalescedSend sends a GET, or waits for the identical one already in flight and shares its reply.
+
+	Requests are identical when they go to the same subject and method with the same encoded payload,
+	for the same user; the payload holds the params and forwarded headers, without the conditional ones.
+ */
+func coalescedSend(subject string, method string, auid string, contentType string, message []byte) (models.Reply, error) {
+
+	h := sha256.New()
+	for _, part := range []string{subject, method, auid, contentType} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(message)
+
+	reply, _, err := inflight.Do(hex.EncodeToString(h.Sum(nil)), func() (models.Reply, error) {
+		return send(subject, "GET", method, contentType, message)
+	})
+
+	return reply, err
+}
+
+/*
+	This is the METRICS Controller. Reports the counters of the gateway.
+
+	URL: /metrics
+	Body: {"coalescing": {"requests": 1200, "coalesced": 830, "in_flight": 2}}
+	requests are the GETs sent to services or coalesced, coalesced the ones that shared the reply of another
+ */
+func (uc MainController) MetricsController(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	if _, valid := auth.VerifyKey(r.Header); valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{"coalescing": inflight.Stats()})
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/composite"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/url"
+)
+
+// composites are the aggregation routes. Configured with COMPOSITES_FILE
+var composites = composite.FromEnv()
+
+/*
+	This is the COMPOSITE Controller. Joins the replies of several services into one JSON document.
+
+	URL: /composite/<name>
+	Params: <name?key=value> URL params are available to the steps as {{request.<key>}}
+
+	The request is authenticated once, every step is dispatched on behalf of the same user.
+ */
+func (uc MainController) CompositeController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	user, valid := auth.VerifyKey(r.Header)
+	if valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	c, found := composites.Lookup(p.ByName("name"))
+	if found == false {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	response := c.Run(r.URL.Query(), func(step composite.Step, params url.Values) composite.Outcome {
+		result := dispatch(user, r.Header, Call{Method: step.Method, Object: step.Object, Op: step.Op, Params: Params(params)})
+		return composite.Outcome{Status: result.Status, Body: result.Body, Error: result.Error}
+	})
+
+	// Set Response Header
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.Status)
+
+	w.Write(response.Body)
+}
@@ -3,14 +3,11 @@ package controllers
 import (
 	"github.com/stevenmahana/ApiMainTemplate/src/models"
 	"github.com/julienschmidt/httprouter"
-	"github.com/nats-io/go-nats"
 	"encoding/json"
 	"net/http"
-	"time"
 	"log"
 	"fmt"
-	"io"
-	"os"
+	"strings"
 )
 
 
@@ -45,7 +42,13 @@ func (uc MainController) Index(resp http.ResponseWriter, req *http.Request, _ ht
 	Version: <method?v=V1.0> The service will create it's own internal version. Default = V1
 	Object: Connects to corresponding micro service which is mapped to database object
 	Method: This tells the service which function to run
-	Params: <method?key=value> URL params can be added to the method to provide additional context to query
+	Params: <method?key=value> URL params can be added to the method to provide additional context to query.
+	Every URL param is forwarded to the service, along with the allow listed headers (FORWARD_HEADERS)
+	Paging: <method?results=25&page=1> or <method?cursor=token> with the cursor from the Link header (rel="next")
+	Streaming: methods the service lists in "streaming" are piped chunk by chunk, see stream
+	Async: <method?async=true> or Prefer: respond-async answers 202 with a job to poll on /jobs/<id>
+	Format: <method?format=csv> or the Accept header; json (default), csv, ndjson, xml or yaml, see render
+	Caching: replies are cached per user for the TTL of the object (CACHE_TTL, CACHE_RULES), If-None-Match answers 304
 
  */
 func (uc MainController) GetController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -68,61 +71,8 @@ func (uc MainController) GetController(w http.ResponseWriter, r *http.Request, p
 		return
 	}
 
-	// Get URL Params ?key=value; Route Params are in "p"
-	q := r.URL.Query()
-
-	// Build Message Payload
-	payload := models.MessagePayload{
-		Auid: user.Auid,
-		Uuid: q.Get("uuid"),
-		Key: q.Get("key"),
-		Keyword: q.Get("keyword"),
-		Perspective: q.Get("perspective"),
-		Body: "",
-		Object: p.ByName("object"),
-		Method: p.ByName("method"),
-		Version: q.Get("v"),
-		Results: q.Get("results"),
-		Page: q.Get("page"),
-		Http_method: "GET",
-	}
-
-	// Subject is mapped to micro service
-	subject := p.ByName("object")
-
-	// Marshal payload into JSON structure
-	mp, _ := json.Marshal(payload)
-
-	// Publish message on subject
-	message := string(mp)
-
-	uri := os.Getenv("NATS_URI")
-
-	// Connect to NATS server; defer close
-	natsConnection, _ := nats.Connect(uri)
-	defer natsConnection.Close()
-
-	log.Println("Connected to " + uri)
-
-	// Set Response Header
-	w.Header().Set("Content-Type", "application/json")
-
-	// Send Message
-	msg, err := natsConnection.Request(subject, []byte(message), 3000*time.Millisecond)
-	if err != nil {
-		log.Println(">>> ERROR: Service Connect Error - ", err)
-
-		// Set HTTP Response Method
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
-	// Set HTTP Response Method
-	w.WriteHeader(http.StatusOK)
-
-	// Response Object is a JSON String; Response Object is created by the service
-	fmt.Fprintf(w, "%s", msg.Data)
-
+	// Run the request as a call, through the same pipeline as batch, composite, GraphQL and WebSocket calls
+	serve(w, r, user, p)
 }
 
 
@@ -133,7 +83,8 @@ func (uc MainController) GetController(w http.ResponseWriter, r *http.Request, p
 	Upload: Fixed
 	Object: Database object
 	Uuid: uuid returned from the server when the object was created.
-	Params: <method?key=value> URL params can be added to the method to provide additional context to query
+	Params: <method?key=value> URL params can be added to the method to provide additional context to query.
+	Every URL param is forwarded to the service, along with the allow listed headers (FORWARD_HEADERS)
  */
 func (uc MainController) UploadController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 
@@ -154,13 +105,22 @@ func (uc MainController) UploadController(w http.ResponseWriter, r *http.Request
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
+	// object must be a registered micro service that accepts the request method
+	service, found := lookup(w, p.ByName("object"), r.Method)
+	if found == false {
+		return
+	}
 
 	// Get URL Params ?key=value; Route Params are in "p"
 	q := r.URL.Query()
 
-	// Read body, check valid JSON, process errors and ensure body size isn't larger than 1M
+	// Read body, check valid JSON, process errors and ensure body size isn't larger than 1M after gzip decompression
+	reader, readable := requestBody(w, r)
+	if readable == false {
+		return
+	}
 	var jbody interface{}
-	err := json.NewDecoder(io.LimitReader(r.Body, 1000000)).Decode(&jbody)
+	err := json.NewDecoder(reader).Decode(&jbody)
 	if err != nil {
 		log.Println(">>> ERROR: JSON Decoder error - ", err)
 
@@ -195,30 +155,34 @@ func (uc MainController) UploadController(w http.ResponseWriter, r *http.Request
 		Results: q.Get("results"),
 		Page: q.Get("page"),
 		Http_method: "POST",
+		Params: q,
+		Headers: forwarded(r.Header),
 	}
 
 	// Subject is mapped to micro service
-	subject := p.ByName("object")
+	subject := service.Subject
 
-	// Marshal payload into JSON structure
-	mp, _ := json.Marshal(payload)
-
-	// Publish message on subject
-	message := string(mp)
-
-	uri := os.Getenv("NATS_URI")
+	// Set Response Header
+	w.Header().Set("Content-Type", "application/json")
 
-	// Connect to NATS server; defer close
-	natsConnection, _ := nats.Connect(uri)
-	defer natsConnection.Close()
+	// Encode payload in the version and wire encoding the service reads
+	message, contentType, err := encode(service, payload)
+	if err != nil {
+		log.Println(">>> ERROR: Payload error - ", err)
 
-	log.Println("Connected to " + uri)
+		// Set HTTP Response Method
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Set Response Header
-	w.Header().Set("Content-Type", "application/json")
+	// Async request; answered with 202 and a job the client polls on /jobs/<id>
+	if wantsAsync(r) {
+		writeResult(w, enqueue(user, service.Object, payload.Method, subject, contentType, message, preferAsync(r)))
+		return
+	}
 
-	// Send Message
-	msg, err := natsConnection.Request(subject, []byte(message), 3000*time.Millisecond)
+	// Send Message; mirrored to the shadow subject when one is configured
+	reply, err := send(subject, r.Method, payload.Method, contentType, message)
 	if err != nil {
 		log.Println(">>> ERROR: Service Connect Error - ", err)
 
@@ -227,13 +191,8 @@ func (uc MainController) UploadController(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	//fmt.Println(string(msg.Data))
-
-	// Set HTTP Response Method
-	w.WriteHeader(http.StatusOK)
-
-	// Response Object is a JSON String; Response Object is created by the service
-	fmt.Fprintf(w, "%s", msg.Data)
+	// Response Object is created by the service; binary replies are converted to JSON
+	respond(w, reply)
 
 }
 
@@ -246,7 +205,9 @@ func (uc MainController) UploadController(w http.ResponseWriter, r *http.Request
 	Version: <method?v=V1.0> The service will create it's own internal version. Default = V1
 	Object: Connects to corresponding micro service which is mapped to database object
 	Method: This tells the service which function to run
-	Params: <method?key=value> URL params can be added to the method to provide additional context to query
+	Params: <method?key=value> URL params can be added to the method to provide additional context to query.
+	Every URL param is forwarded to the service, along with the allow listed headers (FORWARD_HEADERS)
+	Durable: writes of durable objects (DURABLE_OBJECTS) answer 202 with a tracking ID once JetStream stored them, see persist
 
  */
 func (uc MainController) CreateController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -269,86 +230,8 @@ func (uc MainController) CreateController(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get URL Params ?key=value; Route Params are in "p"
-	q := r.URL.Query()
-
-	// Read body, check valid JSON, process errors and ensure body size isn't larger than 1M
-	var jbody interface{}
-	err := json.NewDecoder(io.LimitReader(r.Body, 1000000)).Decode(&jbody)
-	if err != nil {
-		log.Println(">>> ERROR: JSON Decoder error - ", err)
-
-		// Set HTTP Response Method
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
-	defer r.Body.Close() // close body, can cause memory leaks
-
-	// create json string for message body
-	body, err := json.Marshal(jbody)
-	if err != nil {
-		log.Println(">>> ERROR: JSON Marshal error - ", err)
-
-		// Set HTTP Response Method
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
-	// Build Message Payload
-	payload := models.MessagePayload{
-		Auid: user.Auid,
-		Uuid: q.Get("uuid"),
-		Key: q.Get("key"),
-		Keyword: q.Get("keyword"),
-		Perspective: q.Get("perspective"),
-		Body: string(body),
-		Object: p.ByName("object"),
-		Method: p.ByName("method"),
-		Version: q.Get("v"),
-		Results: q.Get("results"),
-		Page: q.Get("page"),
-		Http_method: "POST",
-	}
-
-	// Subject is mapped to micro service
-	subject := p.ByName("object")
-
-	// Marshal payload into JSON structure
-	mp, _ := json.Marshal(payload)
-
-	// Publish message on subject
-	message := string(mp)
-
-	uri := os.Getenv("NATS_URI")
-
-	// Connect to NATS server; defer close
-	natsConnection, _ := nats.Connect(uri)
-	defer natsConnection.Close()
-
-	log.Println("Connected to " + uri)
-
-	// Set Response Header
-	w.Header().Set("Content-Type", "application/json")
-
-	// Send Message
-	msg, err := natsConnection.Request(subject, []byte(message), 3000*time.Millisecond)
-	if err != nil {
-		log.Println(">>> ERROR: Service Connect Error - ", err)
-
-		// Set HTTP Response Method
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
-	//fmt.Println(string(msg.Data))
-
-	// Set HTTP Response Method
-	w.WriteHeader(http.StatusOK)
-
-	// Response Object is a JSON String; Response Object is created by the service
-	fmt.Fprintf(w, "%s", msg.Data)
-
+	// Run the request as a call, through the same pipeline as batch, composite, GraphQL and WebSocket calls
+	serve(w, r, user, p)
 }
 
 
@@ -360,7 +243,9 @@ func (uc MainController) CreateController(w http.ResponseWriter, r *http.Request
 	Version: <method?v=V1.0> The service will create it's own internal version. Default = V1
 	Object: Connects to corresponding micro service which is mapped to database object
 	Method: This tells the service which function to run
-	Params: <method?key=value> URL params can be added to the method to provide additional context to query
+	Params: <method?key=value> URL params can be added to the method to provide additional context to query.
+	Every URL param is forwarded to the service, along with the allow listed headers (FORWARD_HEADERS)
+	Durable: writes of durable objects (DURABLE_OBJECTS) answer 202 with a tracking ID once JetStream stored them, see persist
 
  */
 func (uc MainController) UpdateController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -383,85 +268,117 @@ func (uc MainController) UpdateController(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get URL Params ?key=value; Route Params are in "p"
-	q := r.URL.Query()
+	// Run the request as a call, through the same pipeline as batch, composite, GraphQL and WebSocket calls
+	serve(w, r, user, p)
+}
 
-	// Read body, check valid JSON, process errors and ensure body size isn't larger than 1M
-	var jbody interface{}
-	err := json.NewDecoder(io.LimitReader(r.Body, 1000000)).Decode(&jbody)
-	if err != nil {
-		log.Println(">>> ERROR: JSON Decoder error - ", err)
 
-		// Set HTTP Response Method
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
+/*
+	This is the PATCH Controller of all micro services.
+	This is a generic controller that partially updates objects.
 
-	defer r.Body.Close() // close body, can cause memory leaks
+	URL: /<service>/<object>/<method>
+	Version: <method?v=V1.0> The service will create it's own internal version. Default = V1
+	Object: Connects to corresponding micro service which is mapped to database object
+	Method: This tells the service which function to run
+	Params: <method?key=value> URL params can be added to the method to provide additional context to query.
+	Every URL param is forwarded to the service, along with the allow listed headers (FORWARD_HEADERS)
+	Body: JSON Merge Patch (application/merge-patch+json) or JSON Patch (application/json-patch+json).
+	application/json bodies are JSON Patch when they are a list, merge patch otherwise.
+	The patch format is forwarded in the payload headers (Content-Type) so the service knows how to apply the patch
+	Durable: writes of durable objects (DURABLE_OBJECTS) answer 202 with a tracking ID once JetStream stored them, see persist
 
-	// create json string for message body
-	body, err := json.Marshal(jbody)
-	if err != nil {
-		log.Println(">>> ERROR: JSON Marshal error - ", err)
+ */
+func (uc MainController) PatchController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 
-		// Set HTTP Response Method
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyPatchHeader(r.Header) == false {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
-
-	// Build Message Payload
-	payload := models.MessagePayload{
-		Auid: user.Auid,
-		Uuid: q.Get("uuid"),
-		Key: q.Get("key"),
-		Keyword: q.Get("keyword"),
-		Perspective: q.Get("perspective"),
-		Body: string(body),
-		Object: p.ByName("object"),
-		Method: p.ByName("method"),
-		Version: q.Get("v"),
-		Results: q.Get("results"),
-		Page: q.Get("page"),
-		Http_method: "PUT",
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	user, valid := auth.VerifyKey(r.Header)
+	if valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
 	}
 
-	// Subject is mapped to micro service
-	subject := p.ByName("object")
+	// Run the request as a call, through the same pipeline as batch, composite, GraphQL and WebSocket calls
+	serve(w, r, user, p)
+}
 
-	// Marshal payload into JSON structure
-	mp, _ := json.Marshal(payload)
 
-	// Publish message on subject
-	message := string(mp)
+/*
+	This is the HEAD Controller of all micro services.
+	Runs the GET Controller and returns its status and headers without the body.
 
-	uri := os.Getenv("NATS_URI")
+	URL: /<service>/<object>/<method>
+ */
+func (uc MainController) HeadController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	uc.GetController(headWriter{w}, r, p)
+}
 
-	// Connect to NATS server; defer close
-	natsConnection, _ := nats.Connect(uri)
-	defer natsConnection.Close()
+// headWriter drops the response body of HEAD requests
+type headWriter struct {
+	http.ResponseWriter
+}
 
-	log.Println("Connected to " + uri)
+func (hw headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
 
-	// Set Response Header
-	w.Header().Set("Content-Type", "application/json")
 
-	// Send Message
-	msg, err := natsConnection.Request(subject, []byte(message), 3000*time.Millisecond)
-	if err != nil {
-		log.Println(">>> ERROR: Service Connect Error - ", err)
+/*
+	This is the OPTIONS Controller of all micro services.
+	Reports the HTTP methods the object accepts (Allow header) and the methods and versions of its service.
 
-		// Set HTTP Response Method
+	URL: /<service>/<object>/<method>
+ */
+func (uc MainController) OptionsController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	if _, valid := auth.VerifyKey(r.Header); valid == false {
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
+	// object must be a registered micro service
+	service, found := lookup(w, p.ByName("object"), r.Method)
+	if found == false {
+		return
+	}
+
+	allow := service.Allow()
 
-	//fmt.Println(string(msg.Data))
+	out, _ := json.Marshal(map[string]interface{}{
+		"object": service.Object,
+		"allow": allow,
+		"methods": service.Methods,
+		"versions": service.Versions,
+	})
 
-	// Set HTTP Response Method
+	// Set Response Header
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	// Response Object is a JSON String; Response Object is created by the service
-	fmt.Fprintf(w, "%s", msg.Data)
+	w.Write(out)
 }
 
 
@@ -473,7 +390,9 @@ func (uc MainController) UpdateController(w http.ResponseWriter, r *http.Request
 	Version: <method?v=V1.0> The service will create it's own internal version. Default = V1
 	Object: Connects to corresponding micro service which is mapped to database object
 	Method: This tells the service which function to run
-	Params: <method?key=value> URL params can be added to the method to provide additional context to query
+	Params: <method?key=value> URL params can be added to the method to provide additional context to query.
+	Every URL param is forwarded to the service, along with the allow listed headers (FORWARD_HEADERS)
+	Durable: writes of durable objects (DURABLE_OBJECTS) answer 202 with a tracking ID once JetStream stored them, see persist
 
  */
 func (uc MainController) RemoveController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -496,60 +415,6 @@ func (uc MainController) RemoveController(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get URL Params ?key=value; Route Params are in "p"
-	q := r.URL.Query()
-
-	// Build Message Payload
-	payload := models.MessagePayload{
-		Auid: user.Auid,
-		Uuid: q.Get("uuid"),
-		Key: q.Get("key"),
-		Keyword: q.Get("keyword"),
-		Perspective: q.Get("perspective"),
-		Body: "",
-		Object: p.ByName("object"),
-		Method: p.ByName("method"),
-		Version: q.Get("v"),
-		Results: q.Get("results"),
-		Page: q.Get("page"),
-		Http_method: "DELETE",
-	}
-
-	// Subject is mapped to micro service
-	subject := p.ByName("object")
-
-	// Marshal payload into JSON structure
-	mp, _ := json.Marshal(payload)
-
-	// Publish message on subject
-	message := string(mp)
-
-	uri := os.Getenv("NATS_URI")
-
-	// Connect to NATS server; defer close
-	natsConnection, _ := nats.Connect(uri)
-	defer natsConnection.Close()
-
-	log.Println("Connected to " + uri)
-
-	// Set Response Header
-	w.Header().Set("Content-Type", "application/json")
-
-	// Send Message
-	msg, err := natsConnection.Request(subject, []byte(message), 3000*time.Millisecond)
-	if err != nil {
-		log.Println(">>> ERROR: Service Connect Error - ", err)
-
-		// Set HTTP Response Method
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
-
-	//fmt.Println(string(msg.Data))
-
-	// Set HTTP Response Method
-	w.WriteHeader(http.StatusOK)
-
-	// Response Object is a JSON String; Response Object is created by the service
-	fmt.Fprintf(w, "%s", msg.Data)
+	// Run the request as a call, through the same pipeline as batch, composite, GraphQL and WebSocket calls
+	serve(w, r, user, p)
 }
\ No newline at end of file
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/nats-io/nats.go"
+	"encoding/json"
+	"net/http"
+	"time"
+	"log"
+	"os"
+)
+
+/*
+	Discover keeps the service registry up to date with the heartbeat announcements micro services
+	publish on the discovery subject. The connection stays open for the life of the gateway.
+
+	DISCOVERY_SUBJECT: subject services announce themselves on. Default = gateway.discovery
+ */
+func (uc MainController) Discover() error {
+
+	subject := os.Getenv("DISCOVERY_SUBJECT")
+	if subject == "" {
+		subject = "gateway.discovery"
+	}
+
+	uri := os.Getenv("NATS_URI")
+
+	// Connect to NATS server; reconnect forever
+	natsConnection, err := nats.Connect(uri, nats.MaxReconnects(-1))
+	if err != nil {
+		return err
+	}
+
+	if _, err := services.Listen(natsConnection, subject, 5*time.Second); err != nil {
+		natsConnection.Close()
+		return err
+	}
+
+	log.Println("Listening for service announcements on " + subject)
+
+	return nil
+}
+
+/*
+	This is the service catalog. Lists every live micro service with its versions, methods and schema hash.
+
+	URL: /services
+ */
+func (uc MainController) ServicesController(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	if _, valid := auth.VerifyKey(r.Header); valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	catalog, err := json.Marshal(map[string]interface{}{"services": services.List()})
+	if err != nil {
+		log.Println(">>> ERROR: JSON Marshal error - ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Set Response Header
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	w.Write(catalog)
+}
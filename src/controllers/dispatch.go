@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/codec"
+	"github.com/stevenmahana/ApiMainTemplate/src/registry"
+	"github.com/stevenmahana/ApiMainTemplate/src/shadow"
+	"github.com/stevenmahana/ApiMainTemplate/src/compress"
+	"github.com/stevenmahana/ApiMainTemplate/src/format"
+	"github.com/julienschmidt/httprouter"
+	"github.com/nats-io/nats.go"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+	"log"
+	"io"
+	"os"
+)
+
+// services are the objects requests can be sent to. Configured with SERVICES or SERVICES_FILE
+var services = registry.FromEnv()
+
+// mirror copies live requests to shadow subjects. Configured with SHADOW_SUBJECTS
+var mirror = shadow.FromEnv()
+
+/*
+	Lookup the registered micro service of the object.
+
+	Responds 404 for unknown objects and 405 with an Allow header when the object doesn't accept the HTTP method.
+ */
+func lookup(w http.ResponseWriter, object string, httpMethod string) (*registry.Service, bool) {
+
+	service, found := services.Lookup(object)
+	if found == false {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil, false
+	}
+
+	if service.Allows(httpMethod) == false {
+		w.Header().Set("Allow", strings.Join(service.Allow(), ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	return service, true
+}
+
+// forwardHeaders are the HTTP request headers copied into the payload. Configured with FORWARD_HEADERS
+var forwardHeaders = allowList(os.Getenv("FORWARD_HEADERS"))
+
+/*
+	Build the allow list of forwarded headers from a comma separated list of header names.
+
+	Defaults to Accept-Language, If-Match, If-None-Match and User-Agent. Conditional headers are only forwarded with writes.
+	Credentials (Authorization, Key, Cookie) are never forwarded.
+ */
+func allowList(names string) []string {
+
+	if strings.TrimSpace(names) == "" {
+		names = "Accept-Language,If-Match,If-None-Match,User-Agent"
+	}
+
+	var list []string
+	for _, name := range strings.Split(names, ",") {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		switch name {
+		case "", "Authorization", "Key", "Cookie":
+			continue
+		}
+		list = append(list, name)
+	}
+
+	return list
+}
+
+// conditionalHeaders are never forwarded with GETs; they are cached and coalesced across requests, the gateway answers 304 itself (see render)
+var conditionalHeaders = []string{"If-None-Match", "If-Match", "If-Modified-Since", "If-Unmodified-Since"}
+
+// forwarded returns the allow listed headers of the request
+func forwarded(header http.Header) map[string]string {
+
+	headers := map[string]string{}
+	for _, name := range forwardHeaders {
+		if value := header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+
+	return headers
+}
+
+/*
+	Encode the message payload in the version and wire encoding the service reads.
+
+	Services registered with payload v2 or a binary encoding (msgpack, protobuf) get a JSON object body
+	and numeric paging, every other service gets the original (v1) JSON payload.
+	Returns the message and its content type. Fails when the v2 paging params are invalid.
+ */
+func encode(service *registry.Service, payload models.MessagePayload) ([]byte, string, error) {
+
+	c, err := codec.ForName(service.Encoding)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if service.Payload != "v2" && c.ContentType() == codec.JSON {
+		message, err := json.Marshal(payload)
+		return message, codec.JSON, err
+	}
+
+	v2, err := payload.V2()
+	if err != nil {
+		return nil, "", err
+	}
+
+	message, err := c.Marshal(v2)
+	return message, c.ContentType(), err
+}
+
+/*
+	Send the encoded message to the micro service mapped to subject and wait for the reply.
+
+	The content type names the wire encoding of the message, the reply is decoded from the encoding
+	the service answered with. When the subject has a shadow subject configured reads (and writes, when the
+	target opts in) are also sent there. The shadow reply is never returned to the client, it is only compared
+	with the primary reply.
+ */
+func send(subject string, httpMethod string, method string, contentType string, message []byte) (models.Reply, error) {
+
+	uri := os.Getenv("NATS_URI")
+
+	// Connect to NATS server; defer close
+	natsConnection, err := nats.Connect(uri)
+	if err != nil {
+		return models.Reply{}, err
+	}
+	defer natsConnection.Close()
+
+	log.Println("Connected to " + uri)
+
+	// Start shadow request, runs in the background and never blocks the primary request
+	comparison := mirror.Start(subject, httpMethod, method, contentType, message)
+
+	// Send Message
+	request := nats.NewMsg(subject)
+	request.Header.Set(codec.ContentTypeHeader, contentType)
+	request.Data = message
+
+	msg, err := natsConnection.RequestMsg(request, 3000*time.Millisecond)
+	if err != nil {
+		comparison.Primary(models.Reply{}, err)
+		return models.Reply{}, err
+	}
+
+	reply, err := codec.ReadReply(msg)
+
+	// hand primary reply to the shadow comparison
+	comparison.Primary(reply, err)
+
+	return reply, err
+}
+
+/*
+	Respond writes the service reply. The Response Object is created by the service.
+
+	The status and headers come from the reply envelope (or the NATS headers of JSON replies), status defaults to 200.
+ */
+func respond(w http.ResponseWriter, reply models.Reply) {
+
+	for name, value := range reply.Headers {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Type", "Content-Length", "Transfer-Encoding", "Connection":
+			continue
+		}
+		w.Header().Set(name, value)
+	}
+
+	status := reply.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	// Set HTTP Response Method
+	w.WriteHeader(status)
+
+	w.Write(reply.Body)
+}
+
+// writeResult responds with the result of a call; results of calls that didn't reach the service are sent as plain text errors
+func writeResult(w http.ResponseWriter, result Result) {
+
+	if result.Error != "" && result.Body == nil {
+		for name, value := range result.Headers {
+			w.Header().Set(name, value)
+		}
+		http.Error(w, result.Error, result.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	respond(w, models.Reply{Status: result.Status, Headers: result.Headers, Body: result.Body})
+}
+
+/*
+	Serve runs the request of a generic route (/service/<object>/<method>) as a call, see prepare and run.
+
+	The call has the URL params and body of the request, and its Content-Type, Idempotency-Key and Prefer headers.
+	GET (and HEAD) requests of streaming methods are piped chunk by chunk (see stream),
+	the others are answered in the output format the client negotiated (see render).
+ */
+func serve(w http.ResponseWriter, r *http.Request, user *models.User, p httprouter.Params) {
+
+	c := Call{
+		Method: r.Method,
+		Object: p.ByName("object"),
+		Op: p.ByName("method"),
+		Params: Params(r.URL.Query()),
+		ContentType: r.Header.Get("Content-Type"),
+		IdempotencyKey: r.Header.Get("Idempotency-Key"),
+		Async: preferAsync(r),
+	}
+	if c.Method == "HEAD" {
+		c.Method = "GET"
+	}
+
+	// Read body, ensure body size isn't larger than 1M after gzip decompression; JSON is checked by prepare
+	if c.Method == "POST" || c.Method == "PUT" || c.Method == "PATCH" {
+		reader, readable := requestBody(w, r)
+		if readable == false {
+			return
+		}
+		body, err := ioutil.ReadAll(reader)
+		if err != nil {
+			log.Println(">>> ERROR: Request Body error - ", err)
+
+			// Set HTTP Response Method
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		c.Body = body
+
+		defer r.Body.Close() // close body, can cause memory leaks
+	}
+
+	// Output format; <method?format=csv> or the Accept header, 406 when neither can be served
+	output := format.JSON
+	if c.Method == "GET" {
+		var err error
+		if output, err = format.Negotiate(r.URL.Query().Get("format"), r.Header.Get("Accept")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	call, result := prepare(user, r.Header, c)
+	if call == nil {
+		writeResult(w, result)
+		return
+	}
+
+	// Set Response Header
+	w.Header().Set("Content-Type", "application/json")
+
+	// Streaming methods; chunks are piped to the response as they arrive
+	if c.Method == "GET" && call.service.Streams(call.Op) {
+		if err := stream(w, r, call.service.Subject, call.contentType, call.message); err != nil {
+			log.Println(">>> ERROR: Service Stream Error - ", err)
+
+			// Set HTTP Response Method
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		}
+		return
+	}
+
+	result = call.run(user)
+
+	// Response Object is created by the service; replies of GETs are converted to the negotiated output format
+	if c.Method == "GET" && result.Error == "" && result.Status != http.StatusAccepted {
+		render(w, r, models.Reply{Status: result.Status, Headers: result.Headers, Body: result.Body}, output)
+		return
+	}
+
+	writeResult(w, result)
+}
+
+// requestBody is the body of the request, decompressed when it was sent with Content-Encoding: gzip; at most 1M is read
+func requestBody(w http.ResponseWriter, r *http.Request) (io.Reader, bool) {
+
+	reader, err := compress.RequestBody(r, 1000000)
+	if err == compress.ErrEncoding {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+	if err != nil {
+		log.Println(">>> ERROR: Request Body error - ", err)
+
+		// Set HTTP Response Method
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return reader, true
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/schema"
+	"github.com/julienschmidt/httprouter"
+	"encoding/json"
+	"net/http"
+	"fmt"
+)
+
+/*
+	** PUBLIC ROUTES **
+
+	This is the object reference documentation, generated from the typed object definitions.
+
+	URL: /docs or /docs/<object>
+	Params: <?v=V1> version of the object; <?format=json> returns the definitions instead of markdown
+ */
+func (uc MainController) DocsController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	q := r.URL.Query()
+
+	objects := schemas.Objects()
+	if name := p.ByName("object"); name != "" {
+		object, found := schemas.Object(name, q.Get("v"))
+		if found == false {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		objects = []*schema.Object{object}
+	}
+
+	if q.Get("format") == "json" {
+		out, _ := json.Marshal(map[string]interface{}{"objects": objects})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(out)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, schema.Markdown(objects))
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/durable"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/jobs"
+	"encoding/json"
+	"net/http"
+	"log"
+)
+
+// writes stores the writes of durable objects in JetStream. Configured with DURABLE_OBJECTS and DURABLE_*
+var writes = durable.FromEnv()
+
+// durableWrite is the answer to a durable write: its job, plus where the stream stored it
+type durableWrite struct {
+	jobs.Job
+	TrackingID 	string 		`json:"tracking_id"`
+	Stream 		string 		`json:"stream"`
+	Sequence 	uint64 		`json:"sequence"`
+	Duplicate 	bool 		`json:"duplicate"`
+}
+
+/*
+	Persist stores the write of a durable object in the stream and answers 202 Accepted, also while the
+	service is down. The tracking ID is the job of the write: Location is /jobs/<tracking id>.
+
+	Idempotency-Key: writes retried with the same key are stored once, the retry answers with the same
+	tracking ID and "duplicate": true. A key reused for a different write (digest, see durable.Digest) is answered 422.
+ */
+func persist(user *models.User, object string, method string, key string, digest string, contentType string, message []byte) Result {
+
+	id := durable.TrackingID(user.Auid, object, method, key)
+
+	// the job exists before the write, the reply can't arrive first
+	job, existed, err := tracker.Track(id, user.Auid, object, method, digest)
+	if err == jobs.ErrDigest {
+		out, _ := json.Marshal(map[string]string{"error": "Idempotency-Key was used for a different request"})
+		return Result{Status: http.StatusUnprocessableEntity, Body: out, Error: http.StatusText(http.StatusUnprocessableEntity)}
+	}
+	if err != nil {
+		log.Println(">>> ERROR: Job Store Error - ", err)
+		return failed(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	ack, err := writes.Publish(object, method, id, tracker.ReplySubject(id), contentType, message)
+	if err == durable.ErrMethod {
+		return failed(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		log.Println(">>> ERROR: JetStream Publish Error - ", err)
+
+		result := failed(http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+		result.Headers = map[string]string{"Retry-After": "5"}
+		return result
+	}
+
+	// the key was used again after the dedupe window, the write was stored again
+	if existed && ack.Duplicate == false {
+		if job, err = tracker.Restart(job); err != nil {
+			log.Println(">>> ERROR: Job Store Error - ", err)
+		}
+	}
+
+	return accepted(durableWrite{
+		Job: job,
+		TrackingID: id,
+		Stream: ack.Stream,
+		Sequence: ack.Sequence,
+		Duplicate: ack.Duplicate,
+	}, map[string]string{"Location": "/jobs/" + id, "Tracking-Id": id})
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/registry"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/julienschmidt/httprouter"
+	"net/http/httptest"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"os"
+)
+
+// jetStream runs an embedded NATS server with JetStream and points NATS_URI at it
+func jetStream(t *testing.T) {
+
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns.Start()
+	if !ns.ReadyForConnections(5*time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+
+	uri := os.Getenv("NATS_URI")
+	os.Setenv("NATS_URI", ns.ClientURL())
+	t.Cleanup(func() { os.Setenv("NATS_URI", uri) })
+}
+
+// write sends a write of the ledger object through the generic route
+func write(user *models.User, method string, key string, body string) (*httptest.ResponseRecorder, durableWrite) {
+
+	r := httptest.NewRequest(method, "/service/ledger/entry", strings.NewReader(body))
+	r.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	serve(w, r, user, httprouter.Params{{Key: "object", Value: "ledger"}, {Key: "method", Value: "entry"}})
+
+	var answer durableWrite
+	json.Unmarshal(w.Body.Bytes(), &answer)
+	return w, answer
+}
+
+func TestDurableWritesJetStream(t *testing.T) {
+
+	jetStream(t)
+	if err := services.Register(registry.Service{Object: "ledger", Durable: true}); err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Auid: "u1"}
+
+	w, first := write(user, "POST", "key-1", `{"amount": 10}`)
+	if w.Code != http.StatusAccepted || first.Duplicate {
+		t.Fatalf("first write = %d %s", w.Code, w.Body)
+	}
+
+	// a retry with the same key and body is stored once and answers with the same tracking ID
+	w, retry := write(user, "POST", "key-1", `{"amount": 10}`)
+	if w.Code != http.StatusAccepted || !retry.Duplicate || retry.TrackingID != first.TrackingID {
+		t.Fatalf("retry = %d %s, want a duplicate of %s", w.Code, w.Body, first.TrackingID)
+	}
+
+	// the same key with another body is a client error, not a silent duplicate
+	if w, _ := write(user, "POST", "key-1", `{"amount": 99}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key = %d %s, want 422", w.Code, w.Body)
+	}
+
+	// PATCH goes through the stream like every other write
+	w, patch := write(user, "PATCH", "key-2", `{"amount": 11}`)
+	if w.Code != http.StatusAccepted || patch.Stream != writes.Stream || w.Header().Get("Location") != "/jobs/" + patch.TrackingID {
+		t.Fatalf("PATCH = %d %s, want a durable write", w.Code, w.Body)
+	}
+}
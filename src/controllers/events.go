@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/events"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+	"time"
+	"fmt"
+	"log"
+)
+
+var (
+	// hub streams object change events from NATS. Configured with EVENTS_PREFIX and EVENTS_BUFFER
+	hub = events.FromEnv()
+
+	// eventsKeepalive is the seconds between keepalive comments. Configured with EVENTS_KEEPALIVE
+	eventsKeepalive = envInt("EVENTS_KEEPALIVE", 15)
+)
+
+/*
+	This is the EVENTS Controller. Streams the changes of an object as server-sent events.
+
+	URL: /events/<object>
+	Params: <object?perspective=value> only events for the perspective, among the events of the user
+	<object?last_event_id=id> resume after an event, for clients that can't send the Last-Event-ID header
+
+	Only events the user may see are sent, see events.Event.Visible.
+	Each event is "id: <id>", "event: <type>", "data: <JSON event>". A keepalive comment is sent every
+	EVENTS_KEEPALIVE seconds so proxies don't close an idle stream.
+ */
+func (uc MainController) EventsController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	user, valid := auth.VerifyKey(r.Header)
+	if valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// object must be a registered micro service
+	service, found := services.Lookup(p.ByName("object"))
+	if found == false {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	perspective := q.Get("perspective")
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = q.Get("last_event_id")
+	}
+
+	sub, err := hub.Subscribe(service.Object, lastID)
+	if err != nil {
+		log.Println(">>> ERROR: Events Subscribe Error - ", err)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Close()
+
+	// Set Response Header
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would buffer the stream
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", 3000)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(time.Duration(eventsKeepalive) * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive " + strconv.FormatInt(time.Now().Unix(), 10) + "\n\n")
+			flusher.Flush()
+
+		case e, open := <-sub.Events:
+			if !open {
+				// dropped as a slow consumer, the client reconnects with Last-Event-ID
+				return
+			}
+			if e.Visible(user.Auid, perspective) == false {
+				continue
+			}
+
+			data, err := e.Public()
+			if err != nil {
+				log.Println(">>> ERROR: JSON Marshal error - ", err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
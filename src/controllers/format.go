@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/format"
+	"github.com/stevenmahana/ApiMainTemplate/src/cache"
+	"net/http"
+	"strings"
+	"bytes"
+	"log"
+)
+
+/*
+	Render responds with the reply in the output format the client negotiated, see format.Negotiate.
+
+	Only successful replies are converted, errors are sent as the service wrote them.
+	A reply that can't be converted (not JSON) is answered with 406.
+	The ETag of the reply names it in the output format, a request whose If-None-Match lists it gets 304.
+ */
+func render(w http.ResponseWriter, r *http.Request, reply models.Reply, output format.Format) {
+
+	w.Header().Add("Vary", "Accept")
+
+	status := reply.Status
+	if status != 0 && (status < 200 || status > 299) {
+		respond(w, reply)
+		return
+	}
+
+	// Conditional GET; the client already has this representation
+	if etag := takeHeader(&reply, "ETag"); etag != "" {
+		if output.Name != format.JSON.Name {
+			etag = strings.TrimSuffix(etag, "\"") + "-" + output.Name + "\""
+		}
+		setHeader(&reply, "ETag", etag)
+
+		if cache.NotModified(r.Header.Get("If-None-Match"), etag) {
+			notModified(w, reply)
+			return
+		}
+	}
+
+	if output.Name == format.JSON.Name {
+		respond(w, reply)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := output.Write(&buf, reply.Body); err != nil {
+		log.Println(">>> ERROR: " + output.Name + " Format error - ", err)
+
+		// Set HTTP Response Method
+		http.Error(w, "the reply can't be written as " + output.Name, http.StatusNotAcceptable)
+		return
+	}
+
+	w.Header().Set("Content-Type", output.ContentType)
+	reply.Body = buf.Bytes()
+	respond(w, reply)
+}
+
+// notModified responds 304 with the validator and caching headers of the reply, and no body
+func notModified(w http.ResponseWriter, reply models.Reply) {
+
+	w.Header().Del("Content-Type")
+	for name, value := range reply.Headers {
+		switch http.CanonicalHeaderKey(name) {
+		case "Etag", "Cache-Control", "Expires", "Vary", "Age", "X-Cache":
+			w.Header().Set(name, value)
+		}
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/graphql"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/julienschmidt/httprouter"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"log"
+	"io"
+)
+
+var (
+	// graphqlMaxDepth is the deepest selection level of a GraphQL operation. Configured with GRAPHQL_MAX_DEPTH
+	graphqlMaxDepth = envInt("GRAPHQL_MAX_DEPTH", 10)
+
+	// graphqlParallelism is the maximum number of root fields of a query in flight. Configured with GRAPHQL_PARALLELISM
+	graphqlParallelism = envInt("GRAPHQL_PARALLELISM", 8)
+)
+
+// graphqlRequest is the body of a GraphQL request
+type graphqlRequest struct {
+	Query 		string 			`json:"query"`
+	OperationName 	string 			`json:"operationName"`
+	Variables 	map[string]interface{} 	`json:"variables"`
+}
+
+/*
+	This is the GRAPHQL Controller. A GraphQL facade over the generic service routes.
+
+	URL: /graphql
+	Body: {"query": "{ person(uuid: \"1234\") { first_name account { name } } }", "variables": {...}, "operationName": "..."}
+	Params: <graphql?query=...&variables=...&operationName=...> GET requests can only run queries
+
+	The request is authenticated once, every field is dispatched on behalf of the same user.
+	Fields are checked against the object definitions of the schema store, see graphql.Executor.
+	Selections can nest GRAPHQL_MAX_DEPTH levels, root fields of a query run GRAPHQL_PARALLELISM at a time.
+	Responds 200 with {"data": ..., "errors": [...]}, 400 when the document can't be parsed.
+ */
+func (uc MainController) GraphQLController(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	user, valid := auth.VerifyKey(r.Header)
+	if valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var req graphqlRequest
+	if r.Method == "GET" {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if variables := q.Get("variables"); variables != "" {
+			if err := decodeNumbers(strings.NewReader(variables), &req.Variables); err != nil {
+				graphqlError(w, http.StatusBadRequest, "variables must be a JSON object")
+				return
+			}
+		}
+	} else {
+		// Read body, check valid JSON, process errors and ensure body size isn't larger than 1M after gzip decompression
+		reader, readable := requestBody(w, r)
+		if readable == false {
+			return
+		}
+		err := decodeNumbers(reader, &req)
+		if err != nil {
+			log.Println(">>> ERROR: JSON Decoder error - ", err)
+			graphqlError(w, http.StatusBadRequest, "body must be a JSON object with a query")
+			return
+		}
+
+		defer r.Body.Close() // close body, can cause memory leaks
+	}
+
+	doc, err := graphql.Parse(req.Query)
+	if err != nil {
+		graphqlError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	executor := &graphql.Executor{
+		MaxDepth: graphqlMaxDepth,
+		Parallelism: graphqlParallelism,
+		Objects: schemas,
+		Dispatch: func(call graphql.Request) graphql.Outcome {
+			result := dispatch(user, r.Header, Call{Method: call.Method, Object: call.Object, Op: call.Op, Params: Params(call.Params), Body: call.Body})
+			return graphql.Outcome{Status: result.Status, Body: result.Body, Error: result.Error}
+		},
+	}
+
+	response := executor.Execute(doc, req.OperationName, req.Variables, r.Method == "GET")
+
+	out, err := json.Marshal(response)
+	if err != nil {
+		log.Println(">>> ERROR: JSON Marshal error - ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Set Response Header
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	w.Write(out)
+}
+
+// decodeNumbers decodes JSON keeping numbers as written, so ids and amounts reach services unchanged
+func decodeNumbers(r io.Reader, v interface{}) error {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// graphqlError responds with a request error in the GraphQL format
+func graphqlError(w http.ResponseWriter, status int, message string) {
+
+	out, _ := json.Marshal(graphql.Response{Errors: []*graphql.Error{{Message: message}}})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	w.Write(out)
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/jobs"
+	"github.com/julienschmidt/httprouter"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"log"
+)
+
+// tracker runs async requests as jobs. Configured with JOBS_STORE, JOBS_SUBJECT, JOBS_TIMEOUT and JOBS_TTL
+var tracker = jobs.FromEnv()
+
+// wantsAsync reports whether the client asked for an async request: <method?async=true> or Prefer: respond-async
+func wantsAsync(r *http.Request) bool {
+
+	if r.URL.Query().Get("async") == "true" {
+		return true
+	}
+
+	return preferAsync(r)
+}
+
+func preferAsync(r *http.Request) bool {
+	for _, prefer := range r.Header["Prefer"] {
+		for _, preference := range strings.Split(prefer, ",") {
+			if strings.EqualFold(strings.TrimSpace(preference), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+	Enqueue publishes the request as a job and answers 202 Accepted.
+
+	Location is the job URL, /jobs/<id>. The body is the job: {"id": ..., "status": "pending", ...}
+	preferred adds Preference-Applied, for requests that asked with Prefer: respond-async.
+ */
+func enqueue(user *models.User, object string, method string, subject string, contentType string, message []byte, preferred bool) Result {
+
+	job, err := tracker.Start(user.Auid, object, method, subject, contentType, message)
+	if err != nil {
+		log.Println(">>> ERROR: Job Start Error - ", err)
+		return failed(http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+	}
+
+	headers := map[string]string{"Location": "/jobs/" + job.ID}
+	if preferred {
+		headers["Preference-Applied"] = "respond-async"
+	}
+
+	return accepted(job, headers)
+}
+
+// accepted is the 202 Result of a request that was queued, the body is its job
+func accepted(job interface{}, headers map[string]string) Result {
+
+	out, err := json.Marshal(job)
+	if err != nil {
+		log.Println(">>> ERROR: JSON Marshal error - ", err)
+		return failed(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	return Result{Status: http.StatusAccepted, Headers: headers, Body: out}
+}
+
+
+/*
+	This is the JOB Controller. Reports the status of an async request and its result once it is done.
+
+	URL: /jobs/<id>
+
+	Only the user that started the job can read it. Jobs that are not finished carry a Retry-After header.
+	Body: {"id": ..., "status": "pending|running|done|failed", "object": ..., "method": ...,
+	"progress": {...}, "result": {"status": 200, "headers": {...}, "body": {...}}, "error": ...}
+ */
+func (uc MainController) JobController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	user, valid := auth.VerifyKey(r.Header)
+	if valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	job, found, err := tracker.Get(p.ByName("id"), user.Auid)
+	if err != nil {
+		log.Println(">>> ERROR: Job Store Error - ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if found == false {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	out, err := json.Marshal(job)
+	if err != nil {
+		log.Println(">>> ERROR: JSON Marshal error - ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Set Response Header
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if job.Finished() == false {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	w.Write(out)
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/cursor"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// cursors signs the cursor tokens handed to clients. Configured with CURSOR_SECRET
+var cursors = cursor.FromEnv()
+
+/*
+	Open the cursor token of the request <method?cursor=token> and return the service marker it wraps.
+
+	Returns an empty marker when no cursor was sent. Cursors are only valid for the object and user they were issued for.
+ */
+func cursorMarker(q url.Values, object string, auid string) (string, error) {
+
+	token := q.Get("cursor")
+	if token == "" {
+		return "", nil
+	}
+
+	return cursors.Open(object, auid, token)
+}
+
+/*
+	Paginate turns the paging headers of the service reply into HTTP headers.
+
+	Next-Marker and Prev-Marker become signed cursors in an RFC 8288 Link header (rel="next", rel="prev"),
+	Total-Count becomes X-Total-Count. The raw markers are never sent to the client.
+ */
+func paginate(u *url.URL, object string, auid string, reply *models.Reply) {
+
+	var links []string
+
+	for _, page := range []struct{ header, rel string }{{"Next-Marker", "next"}, {"Prev-Marker", "prev"}} {
+		marker := takeHeader(reply, page.header)
+		if marker == "" {
+			continue
+		}
+
+		// same request, with the page param replaced by the cursor
+		q := u.Query()
+		q.Del("page")
+		q.Set("cursor", cursors.Issue(object, auid, marker))
+
+		links = append(links, "<" + u.Path + "?" + q.Encode() + ">; rel=\"" + page.rel + "\"")
+	}
+
+	if len(links) > 0 {
+		setHeader(reply, "Link", strings.Join(links, ", "))
+	}
+
+	if total := takeHeader(reply, "Total-Count"); total != "" {
+		if _, err := strconv.Atoi(total); err == nil {
+			setHeader(reply, "X-Total-Count", total)
+		}
+	}
+}
+
+// takeHeader removes the reply header, names are case insensitive
+func takeHeader(reply *models.Reply, name string) string {
+	for key, value := range reply.Headers {
+		if strings.EqualFold(key, name) {
+			delete(reply.Headers, key)
+			return value
+		}
+	}
+	return ""
+}
+
+func setHeader(reply *models.Reply, name string, value string) {
+	if reply.Headers == nil {
+		reply.Headers = map[string]string{}
+	}
+	reply.Headers[name] = value
+}
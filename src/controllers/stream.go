@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/codec"
+	"github.com/nats-io/nats.go"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"errors"
+	"time"
+	"log"
+	"os"
+)
+
+// streamIdleTimeout is the seconds allowed between two chunks of a stream. Configured with STREAM_IDLE_TIMEOUT
+var streamIdleTimeout = envInt("STREAM_IDLE_TIMEOUT", 30)
+
+// NDJSON is the content type of newline delimited JSON streams, the default of streamed replies
+const NDJSON = "application/x-ndjson"
+
+/*
+	Stream pipes a streamed reply to the response. Used for the methods a service lists in "streaming",
+	whose results don't fit a single NATS message (1MB max payload by default). ex: export
+
+	The request is published with a reply inbox and the header Stream: true.
+	The service publishes the chunks to the inbox in order, with the headers:
+	Stream-Seq: 1, 2, 3, ... the sequence number of the chunk
+	Status, Content-Type and other headers on the first chunk are the status and headers of the response
+	Stream-End: true on the last chunk, its data can be empty
+	Stream-Error: <message> on the last chunk when the stream failed
+
+	Chunks are written as they arrive (chunked transfer encoding). The first chunk must arrive within 3 seconds,
+	the next ones within STREAM_IDLE_TIMEOUT seconds. A failure after the first chunk can't change the status:
+	NDJSON streams end with an {"error": ...} line, other streams are cut off.
+	Streams are not mirrored to shadow subjects.
+
+	Returns an error when no chunk was written, the caller responds.
+ */
+func stream(w http.ResponseWriter, r *http.Request, subject string, contentType string, message []byte) error {
+
+	uri := os.Getenv("NATS_URI")
+
+	// Connect to NATS server; defer close
+	natsConnection, err := nats.Connect(uri)
+	if err != nil {
+		return err
+	}
+	defer natsConnection.Close()
+
+	// chunks are buffered so a fast service doesn't hit the slow consumer limit of the connection
+	inbox := nats.NewInbox()
+	chunks := make(chan *nats.Msg, 256)
+	sub, err := natsConnection.ChanSubscribe(inbox, chunks)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	// Send Message
+	request := nats.NewMsg(subject)
+	request.Header.Set(codec.ContentTypeHeader, contentType)
+	request.Header.Set("Stream", "true")
+	request.Reply = inbox
+	request.Data = message
+
+	if err := natsConnection.PublishMsg(request); err != nil {
+		return err
+	}
+
+	timeout := 3000*time.Millisecond
+	seq := 0
+	ndjson := false
+
+	for {
+		timer := time.NewTimer(timeout)
+
+		var chunk *nats.Msg
+		select {
+		case chunk = <-chunks:
+			timer.Stop()
+		case <-r.Context().Done():
+			// client went away, stop reading
+			timer.Stop()
+			return nil
+		case <-timer.C:
+			if seq == 0 {
+				return nats.ErrTimeout
+			}
+			streamFailed(w, ndjson, "stream timed out after chunk " + strconv.Itoa(seq))
+			return nil
+		}
+
+		seq++
+		if chunk.Header.Get("Stream-Seq") != strconv.Itoa(seq) {
+			if seq == 1 {
+				return errors.New("stream: first chunk is " + chunk.Header.Get("Stream-Seq") + ", expected 1")
+			}
+			streamFailed(w, ndjson, "stream chunk " + strconv.Itoa(seq) + " is missing")
+			return nil
+		}
+
+		if seq == 1 {
+			ndjson = writeStreamHeader(w, chunk)
+			timeout = time.Duration(streamIdleTimeout) * time.Second
+		}
+
+		if len(chunk.Data) > 0 {
+			if _, err := w.Write(chunk.Data); err != nil {
+				return nil
+			}
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		if chunk.Header.Get("Stream-End") == "true" {
+			if message := chunk.Header.Get("Stream-Error"); message != "" {
+				log.Println(">>> ERROR: Stream error - ", message)
+				streamFailed(w, ndjson, message)
+			}
+			return nil
+		}
+	}
+}
+
+// writeStreamHeader writes the status and headers of the first chunk, reports whether the stream is NDJSON
+func writeStreamHeader(w http.ResponseWriter, chunk *nats.Msg) bool {
+
+	status := http.StatusOK
+
+	for name, values := range chunk.Header {
+		if len(values) == 0 || strings.HasPrefix(name, "Nats-") || strings.HasPrefix(name, "Stream") {
+			continue
+		}
+		switch http.CanonicalHeaderKey(name) {
+		case "Status":
+			if s, err := strconv.Atoi(values[0]); err == nil {
+				status = s
+			}
+			continue
+		case "Content-Type", "Content-Length", "Transfer-Encoding", "Connection":
+			continue
+		}
+		w.Header().Set(name, values[0])
+	}
+
+	contentType := chunk.Header.Get(codec.ContentTypeHeader)
+	if contentType == "" {
+		contentType = NDJSON
+	}
+
+	// Set Response Header; no Content-Length, the body is sent in chunks
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	return strings.HasPrefix(contentType, NDJSON)
+}
+
+// streamFailed ends a stream whose status was already sent
+func streamFailed(w http.ResponseWriter, ndjson bool, message string) {
+
+	if ndjson {
+		line, _ := json.Marshal(map[string]string{"error": message})
+		w.Write(append(line, '\n'))
+		return
+	}
+
+	// cut the chunked response off, the client sees an incomplete body
+	panic(http.ErrAbortHandler)
+}
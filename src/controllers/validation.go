@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/registry"
+	"github.com/stevenmahana/ApiMainTemplate/src/schema"
+	"log"
+)
+
+// schemas are the request schemas per object/method/version. Loaded from SCHEMA_DIR and discovery announcements
+var schemas = schema.FromEnv()
+
+func init() {
+	// services can send their schemas with their heartbeat announcement
+	services.Announced = func(service registry.Service) {
+		if err := schemas.Announce(service.Object, service.SchemaHash, service.Schemas); err != nil {
+			log.Println(">>> ERROR: Schema Announcement error - ", err)
+		}
+	}
+	// schemas of a service that stopped announcing itself no longer apply
+	services.Expired = func(service registry.Service) {
+		schemas.Forget(service.Object)
+	}
+}
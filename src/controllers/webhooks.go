@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/webhooks"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/julienschmidt/httprouter"
+	"encoding/json"
+	"net/http"
+	"log"
+)
+
+// hooks delivers object events to the webhook subscriptions of users. Configured with WEBHOOKS_FILE and WEBHOOK_*
+var hooks = webhooks.FromEnv(hub)
+
+/*
+	This is the WEBHOOKS Controller. Registers and lists the webhook subscriptions of the user.
+
+	URL: /webhooks
+	GET: list of subscriptions, secrets are never returned
+	POST: {"object": "person", "events": ["created", "updated"], "url": "https://...", "secret": "..."}
+	events can be left out for every event type, secret is generated when it is left out.
+	"perspective": "admin" receives the events limited to that perspective, when the user is their owner or audience,
+	see events.Event.Visible.
+	Responds 201 with the subscription and its secret, the only time the secret is returned.
+
+	Deliveries are POSTs of the event JSON, signed with the secret, see webhooks.Sign.
+ */
+func (uc MainController) WebhooksController(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	user, valid := auth.VerifyKey(r.Header)
+	if valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "GET" {
+		list := hooks.List(user.Auid)
+		for i := range list {
+			list[i] = list[i].Public()
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": list})
+		return
+	}
+
+	// Read body, check valid JSON, process errors and ensure body size isn't larger than 1M after gzip decompression
+	reader, readable := requestBody(w, r)
+	if readable == false {
+		return
+	}
+	var subscription webhooks.Subscription
+	err := json.NewDecoder(reader).Decode(&subscription)
+	if err != nil {
+		log.Println(">>> ERROR: JSON Decoder error - ", err)
+
+		// Set HTTP Response Method
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close() // close body, can cause memory leaks
+
+	// object must be a registered micro service
+	service, found := services.Lookup(subscription.Object)
+	if found == false {
+		http.Error(w, "unknown object " + subscription.Object, http.StatusNotFound)
+		return
+	}
+
+	subscription.Object = service.Object
+	subscription.Auid = user.Auid
+
+	created, err := hooks.Register(subscription)
+	if err == webhooks.ErrLimit {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Location", "/webhooks/" + created.ID)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+/*
+	This is the WEBHOOK Controller. Reads or removes one webhook subscription of the user.
+
+	URL: /webhooks/<id>
+	GET: the subscription, without its secret
+	DELETE: removes the subscription, pending retries are dropped
+ */
+func (uc MainController) WebhookController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	user, valid := auth.VerifyKey(r.Header)
+	if valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		if hooks.Remove(p.ByName("id"), user.Auid) == false {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	subscription, found := hooks.Get(p.ByName("id"), user.Auid)
+	if found == false {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, subscription.Public())
+}
+
+/*
+	This is the WEBHOOK LOG Controller. Lists the delivery attempts or the dead letters of a subscription.
+
+	URL: /webhooks/<id>/deliveries: the last attempts, newest first
+	URL: /webhooks/<id>/dead-letters: deliveries that failed every attempt, with their payload
+ */
+func (uc MainController) WebhookLogController(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+
+	auth := models.Access()
+	// verify header was set correctly and check for required header elements
+	if auth.VerifyHeader(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	user, valid := auth.VerifyKey(r.Header)
+	if valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	subscription, found := hooks.Get(p.ByName("id"), user.Auid)
+	if found == false {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	switch p.ByName("log") {
+	case "deliveries":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deliveries": hooks.Deliveries(subscription.ID)})
+	case "dead-letters":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"dead_letters": hooks.DeadLetters.List(subscription.ID)})
+	default:
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	}
+}
+
+// writeJSON responds with a JSON document
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		log.Println(">>> ERROR: JSON Marshal error - ", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Set Response Header
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	w.Write(out)
+}
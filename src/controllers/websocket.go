@@ -0,0 +1,459 @@
+package controllers
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/events"
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/cors"
+	"github.com/julienschmidt/httprouter"
+	"github.com/gorilla/websocket"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+	"log"
+)
+
+var (
+	// wsOrigins are the browser origins allowed to open a WebSocket, the CORS rules of CORS_FILE / CORS_ORIGINS
+	wsOrigins = cors.FromEnv()
+
+	// wsMaxSubscriptions is the maximum number of objects a connection subscribes to. Configured with WS_MAX_SUBSCRIPTIONS
+	wsMaxSubscriptions = envInt("WS_MAX_SUBSCRIPTIONS", 16)
+
+	// wsMaxInflight is the maximum number of requests of a connection in flight. Configured with WS_MAX_INFLIGHT
+	wsMaxInflight = envInt("WS_MAX_INFLIGHT", 8)
+
+	// wsSendQueue is the number of messages queued for a connection before it is slowed down. Configured with WS_SEND_QUEUE
+	wsSendQueue = envInt("WS_SEND_QUEUE", 256)
+
+	// wsAuthInterval is the seconds between auth checks of a token without expiry. Configured with WS_AUTH_INTERVAL
+	wsAuthInterval = envInt("WS_AUTH_INTERVAL", 900)
+
+	// wsNow is the clock the token expiry is checked against
+	wsNow = time.Now
+
+	wsUpgrader = websocket.Upgrader{
+		ReadBufferSize: 4096,
+		WriteBufferSize: 4096,
+		CheckOrigin: wsCheckOrigin,
+	}
+)
+
+const (
+	wsWriteWait = 10*time.Second		// time allowed to write a message
+	wsPongWait = 60*time.Second		// time allowed between pongs of the client
+	wsPingInterval = 30*time.Second		// must be less than wsPongWait
+	wsMaxMessage = 1000000			// same limit as request bodies
+)
+
+/*
+	wsMessage is a frame of the WebSocket protocol, in both directions. Frames are JSON text messages.
+
+	Client:
+	{"id": "1", "type": "request", "method": "GET", "object": "person", "op": "get", "params": {"uuid": "1234"}, "body": {...}}
+	{"id": "2", "type": "subscribe", "object": "person", "perspective": "...", "last_event_id": "..."}
+	{"id": "3", "type": "unsubscribe", "object": "person"}
+	{"id": "4", "type": "auth", "authorization": "Bearer ...", "key": "..."}
+	{"id": "5", "type": "ping"}
+
+	Server:
+	{"id": "1", "type": "reply", "status": 200, "headers": {...}, "body": {...}}
+	{"id": "2", "type": "subscribed", "object": "person"}
+	{"type": "event", "object": "person", "event": {"id": ..., "type": "updated", "uuid": ..., "data": {...}}}
+	{"id": "3", "type": "unsubscribed", "object": "person"}
+	{"id": "4", "type": "authenticated"}
+	{"id": "5", "type": "pong"}
+	{"id": "...", "type": "error", "status": 400, "error": "..."}
+ */
+type wsMessage struct {
+	ID 		string 			`json:"id,omitempty"`
+	Type 		string 			`json:"type"`
+	Method 		string 			`json:"method,omitempty"`
+	Object 		string 			`json:"object,omitempty"`
+	Op 		string 			`json:"op,omitempty"`
+	Params 		Params 			`json:"params,omitempty"`
+	Body 		json.RawMessage 	`json:"body,omitempty"`
+	Perspective 	string 			`json:"perspective,omitempty"`
+	LastEventID 	string 			`json:"last_event_id,omitempty"`
+	Authorization 	string 			`json:"authorization,omitempty"`
+	Key 		string 			`json:"key,omitempty"`
+	Status 		int 			`json:"status,omitempty"`
+	Headers 	map[string]string 	`json:"headers,omitempty"`
+	Event 		json.RawMessage 	`json:"event,omitempty"`
+	Error 		string 			`json:"error,omitempty"`
+}
+
+// wsSession is the state of one WebSocket connection
+type wsSession struct {
+	conn 		*websocket.Conn
+	user 		*models.User
+
+	mu 		sync.Mutex
+	header 		http.Header 				// request headers, Authorization and Key are replaced by auth messages
+	subscriptions 	map[string]*events.Subscription 	// key: object
+
+	send 		chan wsMessage 		// queue of the writer
+	inflight 	chan struct{} 		// request slots
+	reauthed 	chan struct{} 		// wakes the auth loop after an auth message
+	done 		chan struct{} 		// closed when the connection closes
+	once 		sync.Once
+}
+
+/*
+	This is the WEBSOCKET Controller. Carries requests, replies and object events over one connection.
+
+	URL: /ws
+
+	The connection is authenticated on connect (Authorization and Key headers) and again when the token
+	expires, or every WS_AUTH_INTERVAL seconds for tokens without expiry. Clients send an auth message with
+	new credentials before that. A connection that fails the check, or whose token expired, is closed with
+	1008 (policy violation). An expired token can't open a connection (401).
+
+	Backpressure: replies and events go through a queue of WS_SEND_QUEUE messages. When it is full, requests
+	wait for it, and once WS_MAX_INFLIGHT requests wait the connection stops reading. Subscriptions that
+	can't keep up are dropped with an unsubscribed message, clients subscribe again with last_event_id.
+ */
+func (uc MainController) WebSocketController(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+
+	auth := models.Access()
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(r.Header) == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// verify key exists, matches key in cache
+	user, valid := auth.VerifyKey(r.Header)
+	if valid == false {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	// the session would be closed at its first check
+	if wsExpired(r.Header) {
+		http.Error(w, "authorization expired", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already responded
+		log.Println(">>> ERROR: WebSocket Upgrade error - ", err)
+		return
+	}
+
+	s := &wsSession{
+		conn: conn,
+		user: user,
+		header: r.Header.Clone(),
+		subscriptions: map[string]*events.Subscription{},
+		send: make(chan wsMessage, wsSendQueue),
+		inflight: make(chan struct{}, wsMaxInflight),
+		reauthed: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	go s.writer()
+	go s.authLoop()
+
+	s.reader()
+	s.close(websocket.CloseNormalClosure, "")
+}
+
+// wsCheckOrigin allows clients without an Origin, the same origin and the origins of the CORS rules
+func wsCheckOrigin(r *http.Request) bool {
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return true
+	}
+
+	return wsOrigins.AllowsOrigin(origin)
+}
+
+// close ends the session once: close frame, subscriptions, connection
+func (s *wsSession) close(code int, reason string) {
+	s.once.Do(func() {
+		s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+		close(s.done)
+		s.conn.Close()
+
+		s.mu.Lock()
+		for object, sub := range s.subscriptions {
+			delete(s.subscriptions, object)
+			sub.Close()
+		}
+		s.mu.Unlock()
+	})
+}
+
+// queue a message for the writer, blocks while the queue is full. false when the session is closed
+func (s *wsSession) queue(msg wsMessage) bool {
+	select {
+	case s.send <- msg:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *wsSession) fail(id string, status int, message string) {
+	s.queue(wsMessage{ID: id, Type: "error", Status: status, Error: message})
+}
+
+// writer is the only goroutine that writes data frames
+func (s *wsSession) writer() {
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+
+		case msg := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := s.conn.WriteJSON(msg); err != nil {
+				s.close(websocket.CloseGoingAway, "")
+				return
+			}
+
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				s.close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// reader handles the client messages until the connection closes
+func (s *wsSession) reader() {
+
+	s.conn.SetReadLimit(wsMaxMessage)
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Println(">>> ERROR: WebSocket Read error - ", err)
+			}
+			return
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.fail("", http.StatusBadRequest, "message must be a JSON object")
+			continue
+		}
+
+		switch msg.Type {
+		case "request":
+			// wait for a request slot; the connection isn't read while every slot is busy
+			select {
+			case s.inflight <- struct{}{}:
+			case <-s.done:
+				return
+			}
+			go s.request(msg)
+		case "subscribe":
+			s.subscribe(msg)
+		case "unsubscribe":
+			s.unsubscribe(msg)
+		case "auth":
+			s.reauth(msg)
+		case "ping":
+			s.queue(wsMessage{ID: msg.ID, Type: "pong"})
+		default:
+			s.fail(msg.ID, http.StatusBadRequest, "unknown message type " + strconv.Quote(msg.Type))
+		}
+	}
+}
+
+// request dispatches a service call and queues its reply
+func (s *wsSession) request(msg wsMessage) {
+	defer func() { <-s.inflight }()
+
+	s.mu.Lock()
+	header := s.header.Clone()
+	s.mu.Unlock()
+
+	result := dispatch(s.user, header, Call{Method: msg.Method, Object: msg.Object, Op: msg.Op, Params: msg.Params, Body: msg.Body})
+
+	s.queue(wsMessage{ID: msg.ID, Type: "reply", Status: result.Status, Headers: result.Headers, Body: result.Body, Error: result.Error})
+}
+
+func (s *wsSession) subscribe(msg wsMessage) {
+
+	// object must be a registered micro service
+	service, found := services.Lookup(msg.Object)
+	if found == false {
+		s.fail(msg.ID, http.StatusNotFound, "unknown object " + msg.Object)
+		return
+	}
+
+	s.mu.Lock()
+	if _, ok := s.subscriptions[service.Object]; ok {
+		s.mu.Unlock()
+		s.fail(msg.ID, http.StatusConflict, "already subscribed to " + service.Object)
+		return
+	}
+	if len(s.subscriptions) >= wsMaxSubscriptions {
+		s.mu.Unlock()
+		s.fail(msg.ID, http.StatusTooManyRequests, "at most " + strconv.Itoa(wsMaxSubscriptions) + " subscriptions per connection")
+		return
+	}
+
+	sub, err := hub.Subscribe(service.Object, msg.LastEventID)
+	if err != nil {
+		s.mu.Unlock()
+		log.Println(">>> ERROR: Events Subscribe Error - ", err)
+		s.fail(msg.ID, http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable))
+		return
+	}
+	s.subscriptions[service.Object] = sub
+	s.mu.Unlock()
+
+	s.queue(wsMessage{ID: msg.ID, Type: "subscribed", Object: service.Object})
+
+	go s.forward(service.Object, msg.Perspective, sub)
+}
+
+// forward queues the events the user may see until the subscription ends
+func (s *wsSession) forward(object string, perspective string, sub *events.Subscription) {
+
+	for e := range sub.Events {
+		if e.Visible(s.user.Auid, perspective) == false {
+			continue
+		}
+
+		data, err := e.Public()
+		if err != nil {
+			log.Println(">>> ERROR: JSON Marshal error - ", err)
+			continue
+		}
+		if s.queue(wsMessage{Type: "event", Object: object, Event: data}) == false {
+			return
+		}
+	}
+
+	// still registered: the hub dropped it as a slow consumer
+	s.mu.Lock()
+	dropped := s.subscriptions[object] == sub
+	if dropped {
+		delete(s.subscriptions, object)
+	}
+	s.mu.Unlock()
+
+	if dropped {
+		s.queue(wsMessage{Type: "unsubscribed", Object: object, Error: "events were not read fast enough, subscribe again with last_event_id"})
+	}
+}
+
+func (s *wsSession) unsubscribe(msg wsMessage) {
+
+	s.mu.Lock()
+	sub, ok := s.subscriptions[msg.Object]
+	delete(s.subscriptions, msg.Object)
+	s.mu.Unlock()
+
+	if !ok {
+		s.fail(msg.ID, http.StatusNotFound, "not subscribed to " + msg.Object)
+		return
+	}
+
+	sub.Close()
+	s.queue(wsMessage{ID: msg.ID, Type: "unsubscribed", Object: msg.Object})
+}
+
+// reauth replaces the credentials of the session, they must belong to the same user
+func (s *wsSession) reauth(msg wsMessage) {
+
+	s.mu.Lock()
+	header := s.header.Clone()
+	s.mu.Unlock()
+
+	header.Set("Authorization", msg.Authorization)
+	header.Set("Key", msg.Key)
+
+	user, valid := s.verify(header)
+	if valid == false || user.Auid != s.user.Auid {
+		s.fail(msg.ID, http.StatusUnauthorized, "authorization failed")
+		s.close(websocket.ClosePolicyViolation, "authorization failed")
+		return
+	}
+
+	s.mu.Lock()
+	s.header = header
+	s.mu.Unlock()
+
+	select {
+	case s.reauthed <- struct{}{}:
+	default:
+	}
+
+	s.queue(wsMessage{ID: msg.ID, Type: "authenticated"})
+}
+
+// authLoop checks the credentials again when the token expires, the check fails once it has expired
+func (s *wsSession) authLoop() {
+
+	for {
+		s.mu.Lock()
+		header := s.header
+		s.mu.Unlock()
+
+		wait := time.Duration(wsAuthInterval) * time.Second
+		if expires, ok := models.Access().TokenExpiry(header); ok && expires.Sub(wsNow()) < wait {
+			wait = expires.Sub(wsNow())
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.done:
+			timer.Stop()
+			return
+		case <-s.reauthed:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		// an auth message may have replaced the token while the timer fired
+		s.mu.Lock()
+		header = s.header
+		s.mu.Unlock()
+
+		if user, valid := s.verify(header); valid == false || user.Auid != s.user.Auid {
+			s.fail("", http.StatusUnauthorized, "authorization expired")
+			s.close(websocket.ClosePolicyViolation, "authorization expired")
+			return
+		}
+	}
+}
+
+// verify runs the Authorize chain on the credentials of the session
+func (s *wsSession) verify(header http.Header) (*models.User, bool) {
+
+	auth := models.Access()
+	// verify token exists, matches token issued by auth server and is valid
+	if auth.VerifyToken(header) == false || wsExpired(header) {
+		return nil, false
+	}
+	// verify key exists, matches key in cache
+	return auth.VerifyKey(header)
+}
+
+// wsExpired tells if the exp of the token is not after now; tokens without exp don't expire
+func wsExpired(header http.Header) bool {
+	expires, ok := models.Access().TokenExpiry(header)
+	return ok && !expires.After(wsNow())
+}
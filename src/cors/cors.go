@@ -0,0 +1,226 @@
+package cors
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"path"
+	"log"
+	"os"
+)
+
+/*
+	Rule is the CORS configuration of a group of origins.
+
+	Origins can use wildcards. ex: https://*.example.com, http://localhost:*, * for any origin.
+	A rule for any origin (*) never allows credentials, browsers reject that combination.
+ */
+type Rule struct {
+	Origins 	[]string 	`json:"origins"`
+	Methods 	[]string 	`json:"methods,omitempty"`		// Default = every method of the generic routes
+	Headers 	[]string 	`json:"headers,omitempty"`		// request headers. Default = Content-Type, Authorization, Key, ...
+	Expose 		[]string 	`json:"expose,omitempty"`		// response headers readable by the browser. Default = Link, X-Total-Count, ...
+	Credentials 	bool 		`json:"credentials,omitempty"`	// allow cookies and Authorization headers
+	MaxAge 		int 		`json:"max_age,omitempty"`		// seconds a preflight can be cached. Default = 600
+}
+
+/*
+	CORS answers preflight requests and adds the CORS headers to every response of an allowed origin.
+
+	The first rule that matches the Origin of the request is used. Requests without an Origin header
+	or from an origin no rule matches get no CORS headers, preflights from them are rejected with 403.
+	Headers are set before the request is handled so error responses carry them too.
+
+	CORS_FILE: path to a JSON file with a list of rules (per origin configuration)
+	CORS_ORIGINS: comma separated list of origins for a single rule, configured with
+	CORS_METHODS, CORS_HEADERS, CORS_EXPOSE, CORS_CREDENTIALS (true/false) and CORS_MAX_AGE
+ */
+type CORS struct {
+	Rules []Rule
+}
+
+var (
+	defaultMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	defaultHeaders = []string{"Content-Type", "Content-Encoding", "Authorization", "Key", "Accept", "Accept-Language", "If-Match", "If-None-Match",
+		"Idempotency-Key", "Prefer", "Last-Event-ID"}
+	defaultExpose = []string{"Link", "X-Total-Count", "ETag", "Location", "Tracking-Id", "Retry-After", "Preference-Applied", "Age", "X-Cache"}
+)
+
+// New creates the CORS handler config with defaults applied to every rule
+func New(rules []Rule) *CORS {
+
+	for i := range rules {
+		if len(rules[i].Methods) == 0 {
+			rules[i].Methods = defaultMethods
+		}
+		if len(rules[i].Headers) == 0 {
+			rules[i].Headers = defaultHeaders
+		}
+		if len(rules[i].Expose) == 0 {
+			rules[i].Expose = defaultExpose
+		}
+		if rules[i].MaxAge == 0 {
+			rules[i].MaxAge = 600
+		}
+		for j := range rules[i].Methods {
+			rules[i].Methods[j] = strings.ToUpper(rules[i].Methods[j])
+		}
+	}
+
+	return &CORS{Rules: rules}
+}
+
+// FromEnv creates the CORS config from CORS_FILE or the CORS_* variables
+func FromEnv() *CORS {
+
+	var rules []Rule
+
+	if file := os.Getenv("CORS_FILE"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err == nil {
+			err = json.Unmarshal(data, &rules)
+		}
+		if err != nil {
+			log.Println(">>> ERROR: CORS_FILE - ", err)
+		}
+	}
+
+	if origins := list(os.Getenv("CORS_ORIGINS")); len(origins) > 0 {
+		maxAge, _ := strconv.Atoi(os.Getenv("CORS_MAX_AGE"))
+		rules = append(rules, Rule{
+			Origins: origins,
+			Methods: list(os.Getenv("CORS_METHODS")),
+			Headers: list(os.Getenv("CORS_HEADERS")),
+			Expose: list(os.Getenv("CORS_EXPOSE")),
+			Credentials: os.Getenv("CORS_CREDENTIALS") == "true",
+			MaxAge: maxAge,
+		})
+	}
+
+	return New(rules)
+}
+
+// Handler wraps the router with CORS handling
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// response depends on the origin, caches must keep them apart
+		w.Header().Add("Vary", "Origin")
+
+		rule, found := c.match(origin)
+		preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			if found == false || rule.allowsMethod(r.Header.Get("Access-Control-Request-Method")) == false ||
+				rule.allowsHeaders(r.Header.Get("Access-Control-Request-Headers")) == false {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			rule.allowOrigin(w, origin)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(rule.Methods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(rule.Headers, ", "))
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(rule.MaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if found {
+			rule.allowOrigin(w, origin)
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(rule.Expose, ", "))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AllowsOrigin tells if a rule matches the origin, used to check WebSocket handshakes
+func (c *CORS) AllowsOrigin(origin string) bool {
+	_, found := c.match(origin)
+	return found
+}
+
+// match returns the first rule that allows the origin
+func (c *CORS) match(origin string) (*Rule, bool) {
+	for i := range c.Rules {
+		for _, pattern := range c.Rules[i].Origins {
+			if pattern == "*" || pattern == origin {
+				return &c.Rules[i], true
+			}
+			if ok, _ := path.Match(pattern, origin); ok {
+				return &c.Rules[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (rule *Rule) allowOrigin(w http.ResponseWriter, origin string) {
+
+	if rule.anyOrigin() {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if rule.Credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (rule *Rule) anyOrigin() bool {
+	for _, pattern := range rule.Origins {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *Rule) allowsMethod(method string) bool {
+	for _, allowed := range rule.Methods {
+		if allowed == strings.ToUpper(method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders checks every header of Access-Control-Request-Headers is allowed, names are case insensitive
+func (rule *Rule) allowsHeaders(requested string) bool {
+	for _, header := range list(requested) {
+		allowed := false
+		for _, name := range rule.Headers {
+			if strings.EqualFold(name, header) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// list splits a comma separated list and drops empty entries
+func list(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
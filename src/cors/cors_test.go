@@ -0,0 +1,97 @@
+package cors
+
+import (
+	"net/http/httptest"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func preflight(c *CORS, origin string, method string, headers string) *httptest.ResponseRecorder {
+
+	r := httptest.NewRequest("OPTIONS", "/service/person/list", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	w := httptest.NewRecorder()
+	c.Handler(http.NotFoundHandler()).ServeHTTP(w, r)
+	return w
+}
+
+func TestPreflightDefaultHeaders(t *testing.T) {
+
+	c := New([]Rule{{Origins: []string{"https://app.example.com"}}})
+
+	for _, test := range []struct {
+		method 	string
+		headers string
+		want 	int
+	}{
+		{"POST", "content-type, idempotency-key", http.StatusNoContent},
+		{"POST", "Prefer", http.StatusNoContent},
+		{"GET", "last-event-id", http.StatusNoContent},
+		{"PATCH", "Content-Type, If-Match, Authorization, Key", http.StatusNoContent},
+		{"POST", "X-Custom", http.StatusForbidden},
+		{"TRACE", "", http.StatusForbidden},
+	} {
+		if w := preflight(c, "https://app.example.com", test.method, test.headers); w.Code != test.want {
+			t.Errorf("%s %s: status %d, want %d", test.method, test.headers, w.Code, test.want)
+		}
+	}
+}
+
+func TestExposeDefaultHeaders(t *testing.T) {
+
+	c := New([]Rule{{Origins: []string{"https://app.example.com"}}})
+
+	r := httptest.NewRequest("GET", "/service/person/list", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	c.Handler(http.NotFoundHandler()).ServeHTTP(w, r)
+
+	expose := w.Header().Get("Access-Control-Expose-Headers")
+	for _, name := range []string{"Tracking-Id", "Retry-After", "Preference-Applied", "Age", "X-Cache", "Link", "X-Total-Count", "ETag", "Location"} {
+		if !strings.Contains(expose, name) {
+			t.Errorf("%s is not exposed: %s", name, expose)
+		}
+	}
+}
+
+func TestWildcardOrigins(t *testing.T) {
+
+	c := New([]Rule{
+		{Origins: []string{"https://*.example.com", "http://localhost:*"}, Credentials: true},
+		{Origins: []string{"*"}, Credentials: true},
+	})
+
+	for _, test := range []struct {
+		origin 		string
+		allow 		string
+		credentials 	string
+	}{
+		{"https://app.example.com", "https://app.example.com", "true"},
+		{"http://localhost:3000", "http://localhost:3000", "true"},
+		{"https://example.com.evil.io", "*", ""},
+		{"https://other.io", "*", ""},
+	} {
+		w := preflight(c, test.origin, "GET", "")
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: status %d", test.origin, w.Code)
+			continue
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != test.allow {
+			t.Errorf("%s: Allow-Origin %q, want %q", test.origin, got, test.allow)
+		}
+		// a rule for any origin never allows credentials
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != test.credentials {
+			t.Errorf("%s: Allow-Credentials %q, want %q", test.origin, got, test.credentials)
+		}
+	}
+
+	only := New([]Rule{{Origins: []string{"https://*.example.com"}}})
+	if w := preflight(only, "https://example.org", "GET", ""); w.Code != http.StatusForbidden {
+		t.Errorf("unmatched origin: status %d, want 403", w.Code)
+	}
+}
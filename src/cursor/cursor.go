@@ -0,0 +1,118 @@
+package cursor
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"errors"
+	"time"
+	"log"
+	"os"
+)
+
+// ErrInvalid is returned for cursors that were tampered with, expired or issued for another object or user
+var ErrInvalid = errors.New("cursor: invalid or expired cursor")
+
+/*
+	Signer issues and opens the opaque cursor tokens used for cursor based paging.
+
+	Services return a "next" (or "prev") marker, the gateway never hands the marker to the client directly.
+	It is wrapped in a token signed with HMAC-SHA256 and bound to the object and the user it was issued for.
+
+	CURSOR_SECRET: signing key. A random key is used when empty, cursors then stop working when the gateway restarts
+	CURSOR_TTL: how long a cursor is valid. Default = 24h
+ */
+type Signer struct {
+	key 	[]byte
+	TTL 	time.Duration
+}
+
+type claims struct {
+	Object 	string 	`json:"o"`
+	Auid 	string 	`json:"u"`
+	Marker 	string 	`json:"m"`
+	Expires int64 	`json:"e"`
+}
+
+// New creates a signer with the key
+func New(key []byte, ttl time.Duration) *Signer {
+	return &Signer{key: key, TTL: ttl}
+}
+
+// FromEnv creates a signer from CURSOR_SECRET and CURSOR_TTL
+func FromEnv() *Signer {
+
+	key := []byte(os.Getenv("CURSOR_SECRET"))
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Println(">>> ERROR: Cursor key error - ", err)
+		}
+		log.Println("CURSOR_SECRET is not set, cursors are only valid until the gateway restarts")
+	}
+
+	ttl := 24*time.Hour
+	if val := os.Getenv("CURSOR_TTL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			ttl = d
+		} else {
+			log.Println(">>> ERROR: CURSOR_TTL - ", err)
+		}
+	}
+
+	return New(key, ttl)
+}
+
+// Issue wraps the service marker into a signed cursor token for the object and user
+func (s *Signer) Issue(object string, auid string, marker string) string {
+
+	data, _ := json.Marshal(claims{
+		Object: object,
+		Auid: auid,
+		Marker: marker,
+		Expires: time.Now().Add(s.TTL).Unix(),
+	})
+
+	body := base64.RawURLEncoding.EncodeToString(data)
+
+	return body + "." + base64.RawURLEncoding.EncodeToString(s.sign(body))
+}
+
+// Open verifies the cursor token and returns the service marker
+func (s *Signer) Open(object string, auid string, token string) (string, error) {
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return "", ErrInvalid
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, s.sign(parts[0])) {
+		return "", ErrInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalid
+	}
+
+	var c claims
+	if err := json.Unmarshal(data, &c); err != nil {
+		return "", ErrInvalid
+	}
+
+	if c.Object != object || c.Auid != auid || time.Now().Unix() > c.Expires {
+		return "", ErrInvalid
+	}
+
+	return c.Marker, nil
+}
+
+func (s *Signer) sign(body string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
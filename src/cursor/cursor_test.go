@@ -0,0 +1,65 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenReturnsMarker(t *testing.T) {
+
+	s := New([]byte("secret"), time.Hour)
+	token := s.Issue("person", "u1", "next-42")
+
+	marker, err := s.Open("person", "u1", token)
+	if err != nil || marker != "next-42" {
+		t.Fatalf("Open = %q, %v", marker, err)
+	}
+}
+
+func TestOpenRejectsTamperedCursor(t *testing.T) {
+
+	s := New([]byte("secret"), time.Hour)
+	token := s.Issue("person", "u1", "next-42")
+	parts := strings.SplitN(token, ".", 2)
+
+	// swap the claims for claims naming another marker, keep the signature
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"o":"person","u":"u1","m":"next-999","e":9999999999}`))
+
+	tokens := map[string]string{
+		"claims": forged + "." + parts[1],
+		"signature": parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte("bad")),
+		"unsigned": parts[0],
+		"key": New([]byte("other"), time.Hour).Issue("person", "u1", "next-42"),
+	}
+
+	for name, token := range tokens {
+		if _, err := s.Open("person", "u1", token); err != ErrInvalid {
+			t.Errorf("%s: Open error = %v, want ErrInvalid", name, err)
+		}
+	}
+}
+
+func TestOpenRejectsOtherObjectOrUser(t *testing.T) {
+
+	s := New([]byte("secret"), time.Hour)
+	token := s.Issue("person", "u1", "next-42")
+
+	if _, err := s.Open("account", "u1", token); err != ErrInvalid {
+		t.Errorf("other object: Open error = %v, want ErrInvalid", err)
+	}
+	if _, err := s.Open("person", "u2", token); err != ErrInvalid {
+		t.Errorf("other user: Open error = %v, want ErrInvalid", err)
+	}
+}
+
+func TestOpenRejectsExpiredCursor(t *testing.T) {
+
+	s := New([]byte("secret"), -2*time.Second)
+	token := s.Issue("person", "u1", "next-42")
+
+	if _, err := s.Open("person", "u1", token); err != ErrInvalid {
+		t.Fatalf("Open error = %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,184 @@
+package durable
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/registry"
+	"github.com/stevenmahana/ApiMainTemplate/src/codec"
+	"github.com/nats-io/nats.go"
+	"crypto/sha256"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"errors"
+	"sync"
+	"time"
+	"log"
+	"os"
+)
+
+/*
+	Writer stores the writes of durable objects in a JetStream stream, so they are accepted while the
+	service that consumes them is down.
+
+	Writes are published to <Prefix>.<object>.<method> with the tracking ID as Nats-Msg-Id. JetStream stores
+	a message ID once within the Window, so a write retried with the same Idempotency-Key is stored once.
+	The stream is created with work queue retention when it doesn't exist, a write is removed once the
+	service acknowledges it. Services consume with a durable consumer filtered on <Prefix>.<object>.>
+	and publish their reply to the Reply-Subject header, which completes the job of the write (see jobs.Tracker).
+
+	DURABLE_OBJECTS: comma separated list of durable objects, in addition to services with "durable": true
+	DURABLE_STREAM: name of the stream. Default = GATEWAY_WRITES
+	DURABLE_PREFIX: subject prefix of the writes. Default = durable
+	DURABLE_DEDUPE_WINDOW: time a tracking ID is remembered by the stream. Default = 2m
+	DURABLE_ACK_TIMEOUT: time JetStream has to acknowledge a write. Default = 5s
+ */
+type Writer struct {
+	Objects 	map[string]bool
+	Stream 		string
+	Prefix 		string
+	Window 		time.Duration
+	AckTimeout 	time.Duration
+
+	mu 		sync.Mutex
+	nc 		*nats.Conn
+	js 		nats.JetStreamContext
+}
+
+// ErrMethod is returned for a method that can't be a subject token
+var ErrMethod = errors.New("durable: invalid method name")
+
+// FromEnv creates the writer from the DURABLE_* variables
+func FromEnv() *Writer {
+
+	w := &Writer{
+		Objects: map[string]bool{},
+		Stream: os.Getenv("DURABLE_STREAM"),
+		Prefix: os.Getenv("DURABLE_PREFIX"),
+		Window: duration("DURABLE_DEDUPE_WINDOW", 2*time.Minute),
+		AckTimeout: duration("DURABLE_ACK_TIMEOUT", 5*time.Second),
+	}
+	if w.Stream == "" {
+		w.Stream = "GATEWAY_WRITES"
+	}
+	if w.Prefix == "" {
+		w.Prefix = "durable"
+	}
+
+	for _, object := range strings.Split(os.Getenv("DURABLE_OBJECTS"), ",") {
+		if object = strings.TrimSpace(object); object != "" {
+			w.Objects[object] = true
+		}
+	}
+
+	return w
+}
+
+func duration(name string, fallback time.Duration) time.Duration {
+	if val := os.Getenv(name); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			return d
+		}
+		log.Println(">>> ERROR: " + name + " is not a duration")
+	}
+	return fallback
+}
+
+// Enabled reports whether the writes of the service go through the stream
+func (w *Writer) Enabled(service *registry.Service) bool {
+	return service.Durable || w.Objects[service.Object]
+}
+
+/*
+	TrackingID identifies a write. Writes with the same Idempotency-Key (key) of the same user, object and
+	method get the same ID, so the stream stores them once. Without a key every write gets a new ID.
+ */
+func TrackingID(auid string, object string, method string, key string) string {
+
+	if key == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		return hex.EncodeToString(b)
+	}
+
+	sum := sha256.Sum256([]byte(auid + "\x00" + object + "\x00" + method + "\x00" + key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Digest identifies the content of a write: the query and body it was sent with
+func Digest(query url.Values, body []byte) string {
+
+	sum := sha256.New()
+	sum.Write([]byte(query.Encode()))
+	sum.Write([]byte("\x00"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+/*
+	Publish stores the write in the stream and waits for the acknowledgement.
+
+	The message carries the Content-Type, Job-Id (the tracking ID) and Reply-Subject headers.
+	PubAck.Duplicate is set when the stream already had a write with this ID.
+ */
+func (w *Writer) Publish(object string, method string, id string, reply string, contentType string, message []byte) (*nats.PubAck, error) {
+
+	if method == "" || strings.ContainsAny(method, ".*> \t\r\n") {
+		return nil, ErrMethod
+	}
+
+	js, err := w.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := nats.NewMsg(w.Prefix + "." + object + "." + method)
+	msg.Header.Set(codec.ContentTypeHeader, contentType)
+	msg.Header.Set("Job-Id", id)
+	msg.Header.Set("Reply-Subject", reply)
+	msg.Data = message
+
+	return js.PublishMsg(msg, nats.MsgId(id), nats.AckWait(w.AckTimeout))
+}
+
+// connect opens the connection and makes sure the stream exists the first time
+func (w *Writer) connect() (nats.JetStreamContext, error) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.js != nil {
+		return w.js, nil
+	}
+
+	// Connect to NATS server; reconnect forever, writes fail with 503 while it is away
+	nc, err := nats.Connect(os.Getenv("NATS_URI"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := nc.JetStream(nats.MaxWait(w.AckTimeout))
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	// an existing stream is used as it is configured
+	_, err = js.StreamInfo(w.Stream)
+	if err == nats.ErrStreamNotFound {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name: w.Stream,
+			Subjects: []string{w.Prefix + ".>"},
+			Retention: nats.WorkQueuePolicy,
+			Storage: nats.FileStorage,
+			Duplicates: w.Window,
+		})
+	}
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	w.nc = nc
+	w.js = js
+	return js, nil
+}
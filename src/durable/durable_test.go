@@ -0,0 +1,80 @@
+package durable
+
+import (
+	"github.com/nats-io/nats-server/v2/server"
+	"net/url"
+	"testing"
+	"time"
+	"os"
+)
+
+// jetStream runs an embedded NATS server with JetStream and points NATS_URI at it
+func jetStream(t *testing.T) {
+
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns.Start()
+	if !ns.ReadyForConnections(5*time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+
+	uri := os.Getenv("NATS_URI")
+	os.Setenv("NATS_URI", ns.ClientURL())
+	t.Cleanup(func() { os.Setenv("NATS_URI", uri) })
+}
+
+func TestDigest(t *testing.T) {
+
+	body := []byte(`{"amount": 10}`)
+	q := url.Values{"account": {"a1"}}
+
+	if Digest(q, body) != Digest(url.Values{"account": {"a1"}}, []byte(`{"amount": 10}`)) {
+		t.Fatal("same write, different digests")
+	}
+	if Digest(q, body) == Digest(q, []byte(`{"amount": 11}`)) {
+		t.Fatal("different bodies, same digest")
+	}
+	if Digest(q, body) == Digest(url.Values{"account": {"a2"}}, body) {
+		t.Fatal("different params, same digest")
+	}
+}
+
+func TestPublishDedupeJetStream(t *testing.T) {
+
+	jetStream(t)
+	w := &Writer{Objects: map[string]bool{}, Stream: "WRITES", Prefix: "durable", Window: time.Minute, AckTimeout: 5*time.Second}
+
+	id := TrackingID("u1", "ledger", "post", "key-1")
+	first, err := w.Publish("ledger", "post", id, "gateway.jobs." + id, "application/json", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry, err := w.Publish("ledger", "post", id, "gateway.jobs." + id, "application/json", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Duplicate || !retry.Duplicate || retry.Sequence != first.Sequence {
+		t.Fatalf("acks = %+v %+v, want the retry stored once", first, retry)
+	}
+
+	other := TrackingID("u1", "ledger", "post", "key-2")
+	ack, err := w.Publish("ledger", "post", other, "gateway.jobs." + other, "application/json", []byte(`{}`))
+	if err != nil || ack.Duplicate {
+		t.Fatalf("new key: %+v %v", ack, err)
+	}
+
+	info, err := w.js.StreamInfo("WRITES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 2 {
+		t.Fatalf("stream has %d writes, want 2", info.State.Msgs)
+	}
+
+	if _, err := w.Publish("ledger", "a.b", id, "", "application/json", nil); err != ErrMethod {
+		t.Fatalf("method with a dot = %v, want ErrMethod", err)
+	}
+}
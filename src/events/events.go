@@ -0,0 +1,77 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+/*
+	Event is a change of an object, published by its micro service on <EVENTS_PREFIX>.<object>.<type>
+	ex: events.person.updated
+
+	Auid is the user that owns the object, Audience the other users allowed to see the event.
+	An event without either is public. Perspectives narrows the event down to the clients of Auid or Audience
+	that asked for one of them; the perspective is sent by the client, so it never grants access by itself.
+	ID is assigned by the gateway, services don't send it.
+ */
+type Event struct {
+	ID 		string 		`json:"id"`
+	Type 		string 		`json:"type"`				// created, updated, removed, ...
+	Object 		string 		`json:"object"`
+	Uuid 		string 		`json:"uuid,omitempty"`			// object that changed
+	Auid 		string 		`json:"auid,omitempty"`
+	Audience 	[]string 	`json:"audience,omitempty"`
+	Perspectives 	[]string 	`json:"perspectives,omitempty"`
+	Data 		json.RawMessage `json:"data,omitempty"`
+	Time 		time.Time 	`json:"time"`
+
+	seq 		uint64
+}
+
+/*
+	Visible tells if the user may receive the event, perspective is the one the client asked for (can be empty).
+
+	An event limited to Perspectives is only visible to the owner or audience of the event, when the client asked
+	for one of them. It is never visible to other users (a perspective is not a proof of access), nor to clients without a perspective.
+ */
+func (e *Event) Visible(auid string, perspective string) bool {
+
+	if e.Auid != "" || len(e.Audience) > 0 {
+		allowed := e.Auid == auid
+		for _, member := range e.Audience {
+			if member == auid {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if len(e.Perspectives) > 0 {
+		// the perspective only narrows down who may see the event, it can't open it up
+		if e.Auid == "" && len(e.Audience) == 0 {
+			return false
+		}
+		for _, p := range e.Perspectives {
+			if p != "" && p == perspective {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// Public is the event as sent to clients, without the authorization fields
+func (e *Event) Public() ([]byte, error) {
+	return json.Marshal(struct {
+		ID 	string 		`json:"id"`
+		Type 	string 		`json:"type"`
+		Object 	string 		`json:"object"`
+		Uuid 	string 		`json:"uuid,omitempty"`
+		Data 	json.RawMessage `json:"data,omitempty"`
+		Time 	time.Time 	`json:"time"`
+	}{e.ID, e.Type, e.Object, e.Uuid, e.Data, e.Time})
+}
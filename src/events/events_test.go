@@ -0,0 +1,39 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestVisible(t *testing.T) {
+
+	public := &Event{}
+	owned := &Event{Auid: "u1", Audience: []string{"u2"}}
+	limited := &Event{Auid: "u1", Audience: []string{"u2"}, Perspectives: []string{"admin", "billing"}}
+	unowned := &Event{Perspectives: []string{"admin"}}
+
+	tests := []struct {
+		name string
+		e *Event
+		auid string
+		perspective string
+		want bool
+	}{
+		{"public", public, "u9", "", true},
+		{"public with perspective", public, "u9", "admin", true},
+		{"owner", owned, "u1", "", true},
+		{"audience", owned, "u2", "", true},
+		{"other user", owned, "u3", "", false},
+		{"listed perspective", limited, "u1", "billing", true},
+		{"listed perspective of the audience", limited, "u2", "admin", true},
+		{"listed perspective of another user", limited, "u9", "admin", false},
+		{"other perspective", limited, "u1", "sales", false},
+		{"no perspective", limited, "u1", "", false},
+		{"perspective without owner", unowned, "u9", "admin", false},
+	}
+
+	for _, test := range tests {
+		if got := test.e.Visible(test.auid, test.perspective); got != test.want {
+			t.Errorf("%s: Visible = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
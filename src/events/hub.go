@@ -0,0 +1,234 @@
+package events
+
+import (
+	"github.com/nats-io/nats.go"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"errors"
+	"sync"
+	"time"
+	"log"
+	"os"
+)
+
+// ErrClosed is returned when the hub can't reach NATS
+var ErrClosed = errors.New("events: no connection to NATS")
+
+/*
+	Hub fans the events of every object out to the clients subscribed to it.
+
+	The first subscriber of an object starts a NATS subscription to <Prefix>.<object>.> that stays open
+	for the life of the gateway, so the last Buffer events of the object are kept for Last-Event-ID resume.
+	Event ids are <boot>-<sequence>, ids of an earlier gateway process resume from the oldest kept event.
+
+	A subscriber that doesn't keep up (its queue of Queue events is full) is dropped,
+	the client is expected to reconnect with the id of the last event it received.
+
+	EVENTS_PREFIX: subject prefix services publish events on. Default = events
+	EVENTS_BUFFER: events kept per object for resume. Default = 1000
+ */
+type Hub struct {
+	Prefix 	string
+	Buffer 	int
+	Queue 	int
+
+	mu 	sync.Mutex
+	nc 	*nats.Conn
+	topics 	map[string]*topic
+	boot 	string
+}
+
+// topic is the event stream of one object
+type topic struct {
+	mu 		sync.Mutex
+	seq 		uint64
+	events 		[]*Event
+	subscribers 	map[*Subscription]bool
+}
+
+// Subscription receives the events of one object
+type Subscription struct {
+	Events 	<-chan *Event 	// closed when the subscriber is dropped or closed
+
+	events 	chan *Event
+	topic 	*topic
+	once 	sync.Once
+}
+
+// New creates a hub
+func New(prefix string, buffer int, queue int) *Hub {
+	return &Hub{
+		Prefix: prefix,
+		Buffer: buffer,
+		Queue: queue,
+		topics: map[string]*topic{},
+		boot: strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+}
+
+// FromEnv creates a hub configured with EVENTS_PREFIX and EVENTS_BUFFER
+func FromEnv() *Hub {
+
+	prefix := os.Getenv("EVENTS_PREFIX")
+	if prefix == "" {
+		prefix = "events"
+	}
+
+	buffer := 1000
+	if n, err := strconv.Atoi(os.Getenv("EVENTS_BUFFER")); err == nil && n >= 0 {
+		buffer = n
+	}
+
+	return New(prefix, buffer, 64)
+}
+
+/*
+	Subscribe to the events of an object.
+
+	Events published after lastID (the id of the last event the client received) that are still kept
+	are queued first. No event is missed or repeated between the replay and live events.
+ */
+func (h *Hub) Subscribe(object string, lastID string) (*Subscription, error) {
+
+	t, err := h.topic(object)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	replay := t.since(h.boot, lastID)
+
+	queue := h.Queue
+	if queue < len(replay) {
+		queue = len(replay)
+	}
+	s := &Subscription{events: make(chan *Event, queue), topic: t}
+	s.Events = s.events
+
+	for _, e := range replay {
+		s.events <- e
+	}
+	t.subscribers[s] = true
+
+	return s, nil
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.topic.mu.Lock()
+	defer s.topic.mu.Unlock()
+
+	s.drop()
+}
+
+// drop removes the subscription, topic lock held
+func (s *Subscription) drop() {
+	s.once.Do(func() {
+		delete(s.topic.subscribers, s)
+		close(s.events)
+	})
+}
+
+// topic returns the stream of the object, subscribing to NATS the first time
+func (h *Hub) topic(object string) (*topic, error) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if t, ok := h.topics[object]; ok {
+		return t, nil
+	}
+
+	if h.nc == nil {
+		// Connect to NATS server; reconnect forever
+		nc, err := nats.Connect(os.Getenv("NATS_URI"), nats.MaxReconnects(-1))
+		if err != nil {
+			log.Println(">>> ERROR: Events Connect Error - ", err)
+			return nil, ErrClosed
+		}
+		h.nc = nc
+	}
+
+	t := &topic{subscribers: map[*Subscription]bool{}}
+
+	subject := h.Prefix + "." + object + ".>"
+	_, err := h.nc.Subscribe(subject, func(msg *nats.Msg) {
+
+		var e Event
+		if err := json.Unmarshal(msg.Data, &e); err != nil {
+			log.Println(">>> ERROR: Event on " + msg.Subject + " is not JSON - ", err)
+			return
+		}
+
+		e.Object = object
+		if e.Type == "" {
+			e.Type = strings.TrimPrefix(msg.Subject, h.Prefix + "." + object + ".")
+		}
+		// the type is written as an SSE field, a line break would start a new field
+		e.Type = strings.NewReplacer("\r", "", "\n", "").Replace(e.Type)
+		if e.Time.IsZero() {
+			e.Time = time.Now().UTC()
+		}
+
+		t.publish(h.boot, h.Buffer, &e)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.topics[object] = t
+
+	return t, nil
+}
+
+// publish numbers the event, keeps it for resume and queues it for every subscriber
+func (t *topic) publish(boot string, buffer int, e *Event) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.seq++
+	e.seq = t.seq
+	e.ID = boot + "-" + strconv.FormatUint(t.seq, 10)
+
+	if buffer > 0 {
+		t.events = append(t.events, e)
+		if len(t.events) > buffer {
+			t.events = append([]*Event{}, t.events[len(t.events)-buffer:]...)
+		}
+	}
+
+	for s := range t.subscribers {
+		select {
+		case s.events <- e:
+		default:
+			// slow consumer, the client resumes from its last event
+			s.drop()
+		}
+	}
+}
+
+// since returns the kept events after lastID, topic lock held
+func (t *topic) since(boot string, lastID string) []*Event {
+
+	if lastID == "" {
+		return nil
+	}
+
+	var seq uint64
+	if i := strings.LastIndex(lastID, "-"); i > 0 && lastID[:i] == boot {
+		seq, _ = strconv.ParseUint(lastID[i+1:], 10, 64)
+	}
+
+	var events []*Event
+	for _, e := range t.events {
+		if e.seq > seq {
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,137 @@
+package format
+
+import (
+	"encoding/json"
+	"bytes"
+	"errors"
+)
+
+// field is a member of a JSON object, objects are kept as a list of fields so the key order of the reply is kept
+type field struct {
+	key 	string
+	value 	interface{}
+}
+
+/*
+	decode reads a JSON document keeping the key order of objects.
+
+	Objects are []field, arrays []interface{}, numbers json.Number, then string, bool or nil.
+	An empty reply (ex: 204) is an empty array, it has no records.
+ */
+func decode(body []byte) (interface{}, error) {
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return []interface{}{}, nil
+	}
+
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+
+	v, err := value(d)
+	if err != nil {
+		return nil, err
+	}
+	if d.More() {
+		return nil, errors.New("format: reply has more than one JSON document")
+	}
+	return v, nil
+}
+
+func value(d *json.Decoder) (interface{}, error) {
+
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case json.Delim('{'):
+		object := []field{}
+		for d.More() {
+			key, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := value(d)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, field{key.(string), v})
+		}
+		_, err = d.Token()
+		return object, err
+
+	case json.Delim('['):
+		list := []interface{}{}
+		for d.More() {
+			v, err := value(d)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		_, err = d.Token()
+		return list, err
+	}
+
+	return t, nil
+}
+
+// records are the rows of a reply: the elements of an array, or the reply itself
+func records(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+	return []interface{}{v}
+}
+
+// scalar formats a value that isn't an object or an array
+func scalar(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case json.Number:
+		return s.String()
+	case bool:
+		if s {
+			return "true"
+		}
+		return "false"
+	}
+	return ""
+}
+
+// encode writes the value back as JSON, in key order
+func encode(buf *bytes.Buffer, v interface{}) {
+
+	switch s := v.(type) {
+	case []field:
+		buf.WriteByte('{')
+		for i, f := range s {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(f.key)
+			buf.Write(key)
+			buf.WriteByte(':')
+			encode(buf, f.value)
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range s {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			encode(buf, e)
+		}
+		buf.WriteByte(']')
+	case json.Number:
+		buf.WriteString(s.String())
+	default:
+		out, _ := json.Marshal(s)
+		buf.Write(out)
+	}
+}
@@ -0,0 +1,140 @@
+package format
+
+import (
+	"strconv"
+	"strings"
+	"errors"
+	"io"
+)
+
+/*
+	Format converts the JSON reply of a service into an output format.
+
+	Write gets the reply body, an array of objects (ex: a list) or a single object,
+	and writes it to the response in the format.
+ */
+type Format struct {
+	Name 		string 		// value of the format param. ex: csv
+	ContentType 	string 		// Content-Type of the response
+	Types 		[]string 	// media types of the Accept header it answers
+	Write 		func(w io.Writer, body []byte) error
+}
+
+// JSON is the format of the service reply, it is written as it is
+var JSON = Format{
+	Name: "json",
+	ContentType: "application/json",
+	Types: []string{"application/json"},
+	Write: func(w io.Writer, body []byte) error {
+		_, err := w.Write(body)
+		return err
+	},
+}
+
+// Formats are the output formats in order of preference, for Accept headers that allow several
+var Formats = []Format{
+	JSON,
+	{Name: "csv", ContentType: "text/csv; charset=utf-8", Types: []string{"text/csv"}, Write: CSV},
+	{Name: "ndjson", ContentType: "application/x-ndjson", Types: []string{"application/x-ndjson", "application/ndjson"}, Write: NDJSON},
+	{Name: "xml", ContentType: "application/xml; charset=utf-8", Types: []string{"application/xml", "text/xml"}, Write: XML},
+	{Name: "yaml", ContentType: "application/yaml", Types: []string{"application/yaml", "application/x-yaml", "text/yaml"}, Write: YAML},
+}
+
+// ErrNotAcceptable is returned by Negotiate when no format can be served
+var ErrNotAcceptable = errors.New("format: not acceptable, use one of json, csv, ndjson, xml, yaml")
+
+/*
+	Negotiate picks the output format of a request.
+
+	The format param (ex: format=csv) wins over the Accept header. Accept is matched with its q-values
+	and wildcards (ex: text/*), an empty Accept is JSON.
+ */
+func Negotiate(param string, accept string) (Format, error) {
+
+	if param != "" {
+		for _, f := range Formats {
+			if strings.EqualFold(f.Name, param) {
+				return f, nil
+			}
+		}
+		return Format{}, ErrNotAcceptable
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return JSON, nil
+	}
+
+	ranges := parseAccept(accept)
+
+	// a media type gets the q of the most specific range that matches it, the highest q wins
+	best, bestQ := -1, 0.0
+	for i, f := range Formats {
+		for _, t := range f.Types {
+			q, specific := 0.0, -1
+			for _, r := range ranges {
+				if m := r.matches(t); m > specific {
+					q, specific = r.q, m
+				}
+			}
+			if q > bestQ {
+				best, bestQ = i, q
+			}
+		}
+	}
+
+	if best < 0 {
+		return Format{}, ErrNotAcceptable
+	}
+	return Formats[best], nil
+}
+
+// mediaRange is one entry of an Accept header
+type mediaRange struct {
+	kind, sub 	string
+	q 		float64
+}
+
+func parseAccept(accept string) []mediaRange {
+
+	var ranges []mediaRange
+	for _, entry := range strings.Split(accept, ",") {
+		params := strings.Split(entry, ";")
+		kind := strings.ToLower(strings.TrimSpace(params[0]))
+		slash := strings.Index(kind, "/")
+		if slash < 0 {
+			continue
+		}
+
+		r := mediaRange{kind: kind[:slash], sub: kind[slash+1:], q: 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+
+		// q=0 is kept, it means not acceptable
+		ranges = append(ranges, r)
+	}
+
+	return ranges
+}
+
+// matches returns how specific the range matches the media type: 2 exact, 1 type wildcard, 0 any type, -1 no match
+func (r mediaRange) matches(mediaType string) int {
+
+	slash := strings.Index(mediaType, "/")
+	kind, sub := mediaType[:slash], mediaType[slash+1:]
+
+	switch {
+	case r.kind == kind && r.sub == sub:
+		return 2
+	case r.kind == kind && r.sub == "*":
+		return 1
+	case r.kind == "*" && r.sub == "*":
+		return 0
+	}
+	return -1
+}
@@ -0,0 +1,273 @@
+package format
+
+import (
+	"encoding/json"
+	"encoding/csv"
+	"encoding/xml"
+	"strings"
+	"bytes"
+	"io"
+)
+
+/*
+	CSV writes one row per record with a header row. Nested objects are flattened to dotted columns
+	(ex: address.city), arrays are written as JSON. Columns are in the order they first appear.
+	Text cells that start with = + - @ are prefixed with ' so spreadsheets don't run them as formulas.
+	A reply without records is written as an empty document.
+ */
+func CSV(w io.Writer, body []byte) error {
+
+	v, err := decode(body)
+	if err != nil {
+		return err
+	}
+
+	var columns []string
+	seen := map[string]bool{}
+	var rows []map[string]string
+
+	for _, record := range records(v) {
+		row := map[string]string{}
+		var order []string
+		if object, ok := record.([]field); ok {
+			flatten("", object, row, &order)
+		} else {
+			row["value"] = cell(record)
+			order = []string{"value"}
+		}
+		rows = append(rows, row)
+
+		for _, column := range order {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	if len(columns) == 0 {
+		return nil
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(columns); err != nil {
+		return err
+	}
+	line := make([]string, len(columns))
+	for _, row := range rows {
+		for i, column := range columns {
+			line[i] = row[column]
+		}
+		if err := out.Write(line); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+
+	return out.Error()
+}
+
+// flatten adds the cells of an object to the row, nested objects with dotted columns, and their columns to order
+func flatten(prefix string, object []field, row map[string]string, order *[]string) {
+	for _, f := range object {
+		if nested, ok := f.value.([]field); ok && len(nested) > 0 {
+			flatten(prefix + f.key + ".", nested, row, order)
+			continue
+		}
+		row[prefix + f.key] = cell(f.value)
+		*order = append(*order, prefix + f.key)
+	}
+}
+
+func cell(v interface{}) string {
+
+	switch s := v.(type) {
+	case []field, []interface{}:
+		var buf bytes.Buffer
+		encode(&buf, s)
+		return buf.String()
+	case string:
+		if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+			return "'" + s
+		}
+	}
+
+	return scalar(v)
+}
+
+// NDJSON writes one JSON line per record
+func NDJSON(w io.Writer, body []byte) error {
+
+	v, err := decode(body)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, record := range records(v) {
+		encode(&buf, record)
+		buf.WriteByte('\n')
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+/*
+	XML writes the records as <results><item>...</item></results>. Object keys become elements,
+	characters that aren't allowed in element names are replaced with _. Array elements are <item>.
+ */
+func XML(w io.Writer, body []byte) error {
+
+	v, err := decode(body)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString("<results>")
+	for _, record := range records(v) {
+		element(&buf, "item", record)
+	}
+	buf.WriteString("</results>\n")
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func element(buf *bytes.Buffer, name string, v interface{}) {
+
+	name = elementName(name)
+
+	switch s := v.(type) {
+	case nil:
+		buf.WriteString("<" + name + "/>")
+		return
+	case []field:
+		buf.WriteString("<" + name + ">")
+		for _, f := range s {
+			element(buf, f.key, f.value)
+		}
+	case []interface{}:
+		buf.WriteString("<" + name + ">")
+		for _, e := range s {
+			element(buf, "item", e)
+		}
+	default:
+		buf.WriteString("<" + name + ">")
+		xml.EscapeText(buf, []byte(scalar(s)))
+	}
+	buf.WriteString("</" + name + ">")
+}
+
+func elementName(key string) string {
+
+	var b strings.Builder
+	for i, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.'):
+		default:
+			c = '_'
+		}
+		b.WriteRune(c)
+	}
+
+	name := b.String()
+	// names starting with xml are reserved
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		name = "_" + name
+	}
+	return name
+}
+
+// YAML writes the reply as a YAML document in block style. Strings are always quoted
+func YAML(w io.Writer, body []byte) error {
+
+	v, err := decode(body)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if inline, ok := yamlInline(v); ok {
+		buf.WriteString(inline + "\n")
+	} else {
+		yamlBlock(&buf, v, 0)
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// yamlBlock writes a non empty object or array, one line per member
+func yamlBlock(buf *bytes.Buffer, v interface{}, indent int) {
+
+	pad := strings.Repeat(" ", indent)
+
+	switch s := v.(type) {
+	case []field:
+		for _, f := range s {
+			buf.WriteString(pad + yamlKey(f.key) + ":")
+			if inline, ok := yamlInline(f.value); ok {
+				buf.WriteString(" " + inline + "\n")
+				continue
+			}
+			buf.WriteString("\n")
+			yamlBlock(buf, f.value, indent + 2)
+		}
+	case []interface{}:
+		for _, e := range s {
+			if inline, ok := yamlInline(e); ok {
+				buf.WriteString(pad + "- " + inline + "\n")
+				continue
+			}
+			// the first line of the element goes after the dash
+			var member bytes.Buffer
+			yamlBlock(&member, e, indent + 2)
+			buf.WriteString(pad + "- ")
+			buf.Write(member.Bytes()[indent+2:])
+		}
+	}
+}
+
+// yamlInline formats scalars and empty objects or arrays, which fit on the line of their key
+func yamlInline(v interface{}) (string, bool) {
+
+	switch s := v.(type) {
+	case []field:
+		return "{}", len(s) == 0
+	case []interface{}:
+		return "[]", len(s) == 0
+	case nil:
+		return "null", true
+	case string:
+		out, _ := json.Marshal(s)
+		return string(out), true
+	}
+
+	return scalar(v), true
+}
+
+// yamlKey leaves plain keys as they are and quotes the others
+func yamlKey(key string) string {
+
+	plain := key != ""
+	for i, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || i > 0 && (c >= '0' && c <= '9' || c == '-')) {
+			plain = false
+			break
+		}
+	}
+	switch strings.ToLower(key) {
+	case "true", "false", "null", "yes", "no", "on", "off", "y", "n":
+		plain = false
+	}
+
+	if plain {
+		return key
+	}
+	out, _ := json.Marshal(key)
+	return string(out)
+}
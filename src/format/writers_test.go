@@ -0,0 +1,85 @@
+package format
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type writerTest struct {
+	name 	string
+	body 	string
+	want 	string
+}
+
+func run(t *testing.T, write func(io.Writer, []byte) error, tests []writerTest) {
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := write(&buf, []byte(test.body)); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if buf.String() != test.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", test.name, buf.String(), test.want)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	run(t, CSV, []writerTest{
+		{"scalar", `42`, "value\n42\n"},
+		{"list of scalars", `["a", true, null]`, "value\na\ntrue\n\n"},
+		{"object", `{"name": "Ann", "age": 30}`, "name,age\nAnn,30\n"},
+		{"nested object", `{"name": "Ann", "address": {"city": "Oslo", "geo": {"lat": 1}}}`, "name,address.city,address.geo.lat\nAnn,Oslo,1\n"},
+		{"header order", `[{"b": 1, "a": 2}, {"c": 3, "a": 4}]`, "b,a,c\n1,2,\n,4,3\n"},
+		{"lists as JSON", `[{"tags": ["x", "y"], "empty": {}}]`, "tags,empty\n\"[\"\"x\"\",\"\"y\"\"]\",{}\n"},
+		{"formula injection", `[{"a": "=SUM(A1)", "b": "+1", "c": "-2", "d": "@cmd", "e": "safe"}]`, "a,b,c,d,e\n'=SUM(A1),'+1,'-2,'@cmd,safe\n"},
+		{"numbers are not escaped", `[{"n": -2}]`, "n\n-2\n"},
+		{"empty list", `[]`, ""},
+		{"empty reply", ``, ""},
+	})
+}
+
+func TestNDJSON(t *testing.T) {
+	run(t, NDJSON, []writerTest{
+		{"scalar", `"a"`, "\"a\"\n"},
+		{"object", `{"b": 1, "a": {"c": null}}`, "{\"b\":1,\"a\":{\"c\":null}}\n"},
+		{"list", `[{"a": 1}, [1, 2], 3]`, "{\"a\":1}\n[1,2]\n3\n"},
+		{"empty list", `[]`, ""},
+		{"empty reply", ``, ""},
+	})
+}
+
+func TestXML(t *testing.T) {
+	head := "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n"
+	run(t, XML, []writerTest{
+		{"scalar", `"a<b"`, head + "<results><item>a&lt;b</item></results>\n"},
+		{"object", `{"name": "Ann", "none": null}`, head + "<results><item><name>Ann</name><none/></item></results>\n"},
+		{"nested object", `{"address": {"city": "Oslo"}}`, head + "<results><item><address><city>Oslo</city></address></item></results>\n"},
+		{"list", `[{"tags": ["x", 1]}, true]`, head + "<results><item><tags><item>x</item><item>1</item></tags></item><item>true</item></results>\n"},
+		{"names", `{"1st": 1, "a b": 2, "xmlns": 3, "": 4, "ok-1.x": 5}`, head + "<results><item><_st>1</_st><a_b>2</a_b><_xmlns>3</_xmlns><_>4</_><ok-1.x>5</ok-1.x></item></results>\n"},
+		{"empty list", `[]`, head + "<results></results>\n"},
+		{"empty reply", ``, head + "<results></results>\n"},
+	})
+}
+
+func TestYAML(t *testing.T) {
+	run(t, YAML, []writerTest{
+		{"scalar", `"a"`, "\"a\"\n"},
+		{"number", `1.5`, "1.5\n"},
+		{"object", `{"name": "Ann", "yes": true, "a b": null}`, "name: \"Ann\"\n\"yes\": true\n\"a b\": null\n"},
+		{"nested object", `{"address": {"city": "Oslo", "tags": []}}`, "address:\n  city: \"Oslo\"\n  tags: []\n"},
+		{"list", `[1, {"a": 1, "b": {"c": 2}}, [3]]`, "- 1\n- a: 1\n  b:\n    c: 2\n- - 3\n"},
+		{"empty list", `[]`, "[]\n"},
+		{"empty reply", ``, "[]\n"},
+	})
+}
+
+func TestWritersRejectInvalidJSON(t *testing.T) {
+	for name, write := range map[string]func(io.Writer, []byte) error{"csv": CSV, "ndjson": NDJSON, "xml": XML, "yaml": YAML} {
+		if err := write(&bytes.Buffer{}, []byte("not json")); err == nil {
+			t.Errorf("%s: no error for a reply that isn't JSON", name)
+		}
+	}
+}
@@ -0,0 +1,740 @@
+package graphql
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/schema"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"bytes"
+	"sync"
+)
+
+// Request is the service call of a field
+type Request struct {
+	Method 	string
+	Object 	string
+	Op 	string
+	Params 	url.Values
+	Body 	json.RawMessage
+}
+
+// Outcome is the reply of a service call
+type Outcome struct {
+	Status 	int
+	Body 	json.RawMessage
+	Error 	string
+}
+
+// Dispatch sends a service call on behalf of the user of the GraphQL request
+type Dispatch func(req Request) Outcome
+
+// Objects looks up object definitions, implemented by schema.Store
+type Objects interface {
+	Object(name string, version string) (*schema.Object, bool)
+}
+
+// Response is the GraphQL response document
+type Response struct {
+	Data 	interface{} 	`json:"data"`
+	Errors 	[]*Error 	`json:"errors,omitempty"`
+}
+
+/*
+	Executor maps GraphQL operations to service calls.
+
+	Root fields are <object> (method get) or <object>_<method>. ex: person(uuid: "1234"), person_list(results: 10)
+	Arguments become URL params, object arguments are flattened the way filters are written:
+	filter: {age: {gt: 30}} is filter[age][gt]=30. Lists are comma separated.
+	Root query fields run concurrently (Parallelism at a time), mutations run in order. The input argument of a mutation is the body,
+	create is a POST, update a PUT, patch a PATCH, remove and delete a DELETE, every other method a POST.
+
+	Selected fields are sent as the fields param and the reply is trimmed to them.
+	When the object has a definition, fields are checked against it and fields with a ref are resolved
+	from the referenced object: the uuids of every record of a level are loaded with a single
+	<ref>/<LoadMethod>?filter[uuid][in]=... request (at most models.MaxResults uuids per request).
+	Selections can nest MaxDepth levels, deeper operations are rejected before any call is made.
+ */
+type Executor struct {
+	Objects 	Objects
+	Dispatch 	Dispatch
+	LoadMethod 	string 		// method that lists objects by uuid. Default = list
+	MaxDepth 	int 		// deepest selection level, root fields are level 1. Default = 10
+	Parallelism 	int 		// root query fields in flight. Default = 8
+}
+
+// run is the state of a single execution
+type run struct {
+	e 		*Executor
+	doc 		*Document
+	variables 	map[string]interface{}
+	mu 		sync.Mutex
+	errors 		[]*Error
+}
+
+/*
+	Execute runs the operation of the document.
+
+	readOnly rejects mutations, used for GET requests.
+ */
+func (e *Executor) Execute(doc *Document, operationName string, variables map[string]interface{}, readOnly bool) Response {
+
+	op, err := doc.Operation(operationName)
+	if err != nil {
+		return Response{Errors: []*Error{err.(*Error)}}
+	}
+	if readOnly && op.Type == "mutation" {
+		return Response{Errors: []*Error{{Message: "mutations must be sent with POST"}}}
+	}
+
+	r := &run{e: e, doc: doc, variables: map[string]interface{}{}}
+	for _, v := range op.Variables {
+		if value, ok := variables[v.Name]; ok {
+			r.variables[v.Name] = value
+		} else if v.HasDefault {
+			r.variables[v.Name] = v.Default
+		}
+	}
+
+	maxDepth := e.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = 10
+	}
+	if r.deeper(op.Selections, 1, maxDepth) {
+		return Response{Errors: []*Error{{Message: "selection is nested deeper than " + strconv.Itoa(maxDepth) + " levels"}}}
+	}
+
+	fields := r.collect(op.Selections, map[string]bool{})
+	values := make([]interface{}, len(fields))
+
+	if op.Type == "mutation" {
+		for i, field := range fields {
+			values[i] = r.root(op.Type, field)
+		}
+	} else {
+		parallelism := e.Parallelism
+		if parallelism <= 0 {
+			parallelism = 8
+		}
+		slots := make(chan struct{}, parallelism)
+
+		var wg sync.WaitGroup
+		for i, field := range fields {
+			wg.Add(1)
+			slots <- struct{}{}
+
+			go func(i int, field *Selection) {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				values[i] = r.root(op.Type, field)
+			}(i, field)
+		}
+		wg.Wait()
+	}
+
+	data := &object{}
+	for i, field := range fields {
+		data.set(field.Key(), values[i])
+	}
+
+	return Response{Data: data, Errors: r.errors}
+}
+
+// deeper reports whether the selections, fragments included, nest deeper than max levels
+func (r *run) deeper(selections []*Selection, level int, max int) bool {
+
+	for _, field := range r.collect(selections, map[string]bool{}) {
+		if len(field.Selections) == 0 {
+			continue
+		}
+		if level+1 > max || r.deeper(field.Selections, level+1, max) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fail records an error of the field at path
+func (r *run) fail(path []interface{}, message string, status int) {
+
+	e := &Error{Message: message, Path: path}
+	if status != 0 {
+		e.Extensions = map[string]interface{}{"status": status}
+	}
+
+	r.mu.Lock()
+	r.errors = append(r.errors, e)
+	r.mu.Unlock()
+}
+
+// root runs the service call of a root field
+func (r *run) root(opType string, field *Selection) interface{} {
+
+	path := []interface{}{field.Key()}
+
+	if field.Name == "__typename" {
+		if opType == "mutation" {
+			return "Mutation"
+		}
+		return "Query"
+	}
+	if strings.HasPrefix(field.Name, "__") {
+		r.fail(path, "introspection is not supported", 0)
+		return nil
+	}
+
+	args, err := r.arguments(field.Args)
+	if err != nil {
+		r.fail(path, err.Error(), 0)
+		return nil
+	}
+
+	version, _ := args["v"].(string)
+	object, op := field.Name, "get"
+	if _, defined := r.e.Objects.Object(object, version); !defined || opType == "mutation" {
+		if i := strings.LastIndex(field.Name, "_"); i > 0 {
+			object, op = field.Name[:i], field.Name[i+1:]
+		} else if opType == "mutation" {
+			r.fail(path, "mutation fields are named <object>_<method>", 0)
+			return nil
+		}
+	}
+	def, _ := r.e.Objects.Object(object, version)
+
+	req := Request{Method: "GET", Object: object, Op: op, Params: url.Values{}}
+
+	if opType == "mutation" {
+		switch op {
+		case "create":
+			req.Method = "POST"
+		case "update":
+			req.Method = "PUT"
+		case "patch":
+			req.Method = "PATCH"
+		case "remove", "delete":
+			req.Method = "DELETE"
+		default:
+			req.Method = "POST"
+		}
+
+		input, ok := args["input"]
+		if !ok {
+			input = map[string]interface{}{}
+		}
+		req.Body, _ = json.Marshal(input)
+		delete(args, "input")
+	}
+
+	for name, value := range args {
+		flatten(name, value, req.Params)
+	}
+
+	fields := r.collect(field.Selections, map[string]bool{})
+	if len(fields) > 0 && req.Params.Get("fields") == "" {
+		req.Params.Set("fields", strings.Join(selected(fields), ","))
+	}
+
+	outcome := r.e.Dispatch(req)
+	if outcome.Status >= 400 {
+		message := outcome.Error
+		if message == "" {
+			message = http.StatusText(outcome.Status)
+		}
+		r.fail(path, message, outcome.Status)
+		return nil
+	}
+
+	value, ok := decode(outcome.Body)
+	if !ok {
+		r.fail(path, "service reply is not JSON", 0)
+		return nil
+	}
+
+	if len(fields) == 0 {
+		return value
+	}
+
+	return r.complete(object, definition(def), value, field.Selections, path)
+}
+
+// complete trims a reply (a record or a list of records) to the selection
+func (r *run) complete(typeName string, fields []schema.Field, value interface{}, selections []*Selection, path []interface{}) interface{} {
+
+	if list, ok := value.([]interface{}); ok {
+		return r.level(typeName, fields, list, selections, path)
+	}
+	if value == nil {
+		return nil
+	}
+
+	return r.level(typeName, fields, []interface{}{value}, selections, path)[0]
+}
+
+/*
+	level builds the output of every record of one level of the response.
+
+	Working on all the records of a level at once is what batches the loading of refs:
+	each ref field of the selection is one load, whatever the number of records.
+	fields is nil when the type has no definition, any field can then be selected.
+ */
+func (r *run) level(typeName string, fields []schema.Field, records []interface{}, selections []*Selection, path []interface{}) []interface{} {
+
+	outs := make([]interface{}, len(records))
+	if len(records) == 0 {
+		return outs
+	}
+
+	objects := make([]*object, len(records))
+	for i, record := range records {
+		if _, ok := record.(map[string]interface{}); ok {
+			objects[i] = &object{}
+			outs[i] = objects[i]
+		}
+	}
+
+	for _, sel := range r.collect(selections, map[string]bool{}) {
+
+		key := sel.Key()
+		fieldPath := append(append([]interface{}{}, path...), key)
+
+		if sel.Name == "__typename" {
+			for _, o := range objects {
+				if o != nil {
+					o.set(key, typeName)
+				}
+			}
+			continue
+		}
+
+		field, known := find(fields, sel.Name)
+		if fields != nil && !known {
+			r.fail(fieldPath, "cannot query field " + sel.Name + " on type " + typeName, 0)
+			continue
+		}
+
+		var values []interface{}
+		switch {
+		case len(sel.Selections) == 0:
+			values = make([]interface{}, len(records))
+			for i, record := range records {
+				if m, ok := record.(map[string]interface{}); ok {
+					values[i] = m[sel.Name]
+				}
+			}
+		case known && field.Ref != "":
+			values = r.refs(field, records, sel, fieldPath)
+		default:
+			var sub []schema.Field
+			if known {
+				sub = field.Fields
+				if field.Items != nil {
+					sub = field.Items.Fields
+				}
+			}
+			values = r.embedded(typeName + "_" + sel.Name, sub, records, sel, fieldPath)
+		}
+
+		for i, o := range objects {
+			if o != nil {
+				o.set(key, values[i])
+			}
+		}
+	}
+
+	return outs
+}
+
+// refs resolves a ref field of every record with one batched load of the referenced object
+func (r *run) refs(field schema.Field, records []interface{}, sel *Selection, path []interface{}) []interface{} {
+
+	// unique uuids of the level, in order of appearance
+	var ids []string
+	seen := map[string]bool{}
+	for _, record := range records {
+		m, _ := record.(map[string]interface{})
+		for _, id := range uuids(m[field.Name]) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	def, _ := r.e.Objects.Object(field.Ref, "")
+	fields := r.collect(sel.Selections, map[string]bool{})
+	// records are matched back by uuid, it is always loaded
+	names := selected(fields)
+	if !contains(names, "uuid") {
+		names = append(names, "uuid")
+	}
+	loaded := r.load(field.Ref, ids, names, path)
+
+	// children of the level are completed together so the next level is batched too
+	var children []interface{}
+	var childIDs []string
+	for _, id := range ids {
+		if record, ok := loaded[id]; ok {
+			children = append(children, record)
+			childIDs = append(childIDs, id)
+		}
+	}
+	outs := r.level(field.Ref, definition(def), children, sel.Selections, path)
+
+	byID := map[string]interface{}{}
+	for i, id := range childIDs {
+		byID[id] = outs[i]
+	}
+
+	values := make([]interface{}, len(records))
+	for i, record := range records {
+		m, _ := record.(map[string]interface{})
+		switch v := m[field.Name].(type) {
+		case string:
+			values[i] = byID[v]
+		case []interface{}:
+			list := make([]interface{}, 0, len(v))
+			for _, id := range uuids(v) {
+				list = append(list, byID[id])
+			}
+			values[i] = list
+		}
+	}
+
+	return values
+}
+
+// load fetches records by uuid, keyed by uuid
+func (r *run) load(object string, ids []string, fields []string, path []interface{}) map[string]interface{} {
+
+	method := r.e.LoadMethod
+	if method == "" {
+		method = "list"
+	}
+
+	loaded := map[string]interface{}{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for start := 0; start < len(ids); start += models.MaxResults {
+		end := start + models.MaxResults
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		wg.Add(1)
+		go func(chunk []string) {
+			defer wg.Done()
+
+			params := url.Values{}
+			params.Set("filter[uuid][in]", strings.Join(chunk, ","))
+			params.Set("results", strconv.Itoa(len(chunk)))
+			params.Set("fields", strings.Join(fields, ","))
+
+			outcome := r.e.Dispatch(Request{Method: "GET", Object: object, Op: method, Params: params})
+			if outcome.Status >= 400 {
+				message := outcome.Error
+				if message == "" {
+					message = http.StatusText(outcome.Status)
+				}
+				r.fail(path, message, outcome.Status)
+				return
+			}
+
+			value, _ := decode(outcome.Body)
+			records, ok := value.([]interface{})
+			if !ok {
+				records = []interface{}{value}
+			}
+
+			mu.Lock()
+			for _, record := range records {
+				if m, ok := record.(map[string]interface{}); ok {
+					if id, ok := m["uuid"].(string); ok {
+						loaded[id] = record
+					}
+				}
+			}
+			mu.Unlock()
+		}(ids[start:end])
+	}
+	wg.Wait()
+
+	return loaded
+}
+
+// embedded completes the nested objects (or lists of objects) of a field of every record
+func (r *run) embedded(typeName string, fields []schema.Field, records []interface{}, sel *Selection, path []interface{}) []interface{} {
+
+	var children []interface{}
+	for _, record := range records {
+		m, _ := record.(map[string]interface{})
+		switch v := m[sel.Name].(type) {
+		case []interface{}:
+			children = append(children, v...)
+		case map[string]interface{}:
+			children = append(children, v)
+		}
+	}
+
+	outs := r.level(typeName, fields, children, sel.Selections, path)
+
+	values := make([]interface{}, len(records))
+	next := 0
+	for i, record := range records {
+		m, _ := record.(map[string]interface{})
+		switch v := m[sel.Name].(type) {
+		case []interface{}:
+			values[i] = outs[next : next+len(v)]
+			next += len(v)
+		case map[string]interface{}:
+			values[i] = outs[next]
+			next++
+		}
+	}
+
+	return values
+}
+
+/*
+	collect expands fragments and applies @skip and @include.
+
+	Fields selected more than once under the same key are merged.
+ */
+func (r *run) collect(selections []*Selection, visiting map[string]bool) []*Selection {
+
+	var fields []*Selection
+	index := map[string]int{}
+
+	var walk func(selections []*Selection)
+	walk = func(selections []*Selection) {
+		for _, s := range selections {
+			if !r.included(s) {
+				continue
+			}
+
+			switch {
+			case s.Spread != "":
+				f, ok := r.doc.Fragments[s.Spread]
+				if !ok || visiting[s.Spread] {
+					continue
+				}
+				visiting[s.Spread] = true
+				walk(f.Selections)
+				visiting[s.Spread] = false
+			case s.Inline:
+				walk(s.Selections)
+			default:
+				if i, ok := index[s.Key()]; ok {
+					merged := *fields[i]
+					merged.Selections = append(append([]*Selection{}, merged.Selections...), s.Selections...)
+					fields[i] = &merged
+					continue
+				}
+				index[s.Key()] = len(fields)
+				fields = append(fields, s)
+			}
+		}
+	}
+	walk(selections)
+
+	return fields
+}
+
+func (r *run) included(s *Selection) bool {
+
+	if args, ok := s.Directives["skip"]; ok {
+		if v, _ := r.value(args["if"]); v == true {
+			return false
+		}
+	}
+	if args, ok := s.Directives["include"]; ok {
+		if v, _ := r.value(args["if"]); v != true {
+			return false
+		}
+	}
+
+	return true
+}
+
+// arguments replaces variables and enums with their values
+func (r *run) arguments(args map[string]interface{}) (map[string]interface{}, error) {
+
+	values := map[string]interface{}{}
+	for name, arg := range args {
+		v, err := r.value(arg)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = v
+	}
+
+	return values, nil
+}
+
+func (r *run) value(v interface{}) (interface{}, error) {
+
+	switch v := v.(type) {
+	case Var:
+		value, ok := r.variables[string(v)]
+		if !ok {
+			return nil, &Error{Message: "variable $" + string(v) + " is not defined"}
+		}
+		return value, nil
+	case Enum:
+		return string(v), nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := r.value(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case map[string]interface{}:
+		return r.arguments(v)
+	}
+
+	return v, nil
+}
+
+// flatten writes an argument as URL params. ex: filter: {age: {gt: 30}} is filter[age][gt]=30
+func flatten(name string, value interface{}, params url.Values) {
+
+	switch v := value.(type) {
+	case nil:
+	case map[string]interface{}:
+		for key, item := range v {
+			flatten(name + "[" + key + "]", item, params)
+		}
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, scalar(item))
+		}
+		params.Set(name, strings.Join(items, ","))
+	default:
+		params.Set(name, scalar(v))
+	}
+}
+
+func scalar(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	out, _ := json.Marshal(value)
+	return string(out)
+}
+
+// selected returns the names of the fields of a selection, sent as the fields param
+func selected(fields []*Selection) []string {
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if !strings.HasPrefix(f.Name, "__") {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// uuids returns the uuid or list of uuids of a ref field
+func uuids(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var ids []string
+		for _, item := range v {
+			if id, ok := item.(string); ok {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	return nil
+}
+
+func definition(def *schema.Object) []schema.Field {
+	if def == nil {
+		return nil
+	}
+	return def.Fields
+}
+
+func find(fields []schema.Field, name string) (schema.Field, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return schema.Field{}, false
+}
+
+// decode a reply body, numbers are kept as written
+func decode(body json.RawMessage) (interface{}, bool) {
+
+	if len(body) == 0 {
+		return nil, true
+	}
+
+	var value interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&value); err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// object is a JSON object that keeps the order of the selection
+type object struct {
+	keys 	[]string
+	values 	map[string]interface{}
+}
+
+func (o *object) set(key string, value interface{}) {
+	if o.values == nil {
+		o.values = map[string]interface{}{}
+	}
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
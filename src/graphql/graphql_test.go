@@ -0,0 +1,120 @@
+package graphql
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/schema"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// noObjects has no object definitions, every field can be selected
+type noObjects struct{}
+
+func (noObjects) Object(name string, version string) (*schema.Object, bool) {
+	return nil, false
+}
+
+func TestParseRejectsFragmentCycles(t *testing.T) {
+
+	documents := map[string]string{
+		"self": `query { person(uuid: "1") { ...F } } fragment F on person { a { ...F } }`,
+		"mutual": `{ person { ...A } } fragment A on person { b { ...B } } fragment B on person { a { ...A } }`,
+		"inline": `{ person { ...A } } fragment A on person { ... on person { a { ...A } } }`,
+		"unused": `{ person { uuid } } fragment A on person { ...A }`,
+	}
+
+	for name, src := range documents {
+		if _, err := Parse(src); err == nil || !strings.Contains(err.Error(), "spreads itself") {
+			t.Errorf("%s: Parse error = %v, want a fragment cycle error", name, err)
+		}
+	}
+}
+
+func TestParseRejectsUnknownFragments(t *testing.T) {
+	if _, err := Parse(`{ person { ...Missing } }`); err == nil {
+		t.Fatal("spread of an unknown fragment was parsed")
+	}
+}
+
+func TestParseAcceptsSharedFragments(t *testing.T) {
+	src := `{ person { ...A b { ...A } } } fragment A on person { uuid ...B } fragment B on person { name }`
+	if _, err := Parse(src); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExecuteRejectsDeepSelections(t *testing.T) {
+
+	doc, err := Parse(`{ person { a { b { c { uuid } } } } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	e := &Executor{Objects: noObjects{}, MaxDepth: 3, Dispatch: func(req Request) Outcome {
+		calls++
+		return Outcome{Status: 200, Body: json.RawMessage(`{}`)}
+	}}
+
+	response := e.Execute(doc, "", nil, true)
+	if len(response.Errors) != 1 || calls != 0 {
+		t.Fatalf("errors = %v, calls = %d", response.Errors, calls)
+	}
+
+	e.MaxDepth = 5
+	if response := e.Execute(doc, "", nil, true); len(response.Errors) != 0 || calls != 1 {
+		t.Fatalf("errors = %v, calls = %d", response.Errors, calls)
+	}
+}
+
+func TestExecuteStopsAtEmptyLevels(t *testing.T) {
+
+	doc, err := Parse(`{ person { ...F } } fragment F on person { uuid friends { uuid friends { uuid } } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Executor{Objects: noObjects{}, Dispatch: func(req Request) Outcome {
+		return Outcome{Status: 200, Body: json.RawMessage(`{"uuid": "1", "friends": []}`)}
+	}}
+
+	out, _ := json.Marshal(e.Execute(doc, "", nil, true))
+	if string(out) != `{"data":{"person":{"uuid":"1","friends":[]}}}` {
+		t.Fatalf("response = %s", out)
+	}
+}
+
+func TestExecuteLimitsRootFieldsInFlight(t *testing.T) {
+
+	doc, err := Parse(`{ a: person { uuid } b: person { uuid } c: person { uuid } d: person { uuid } e: person { uuid } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	inFlight, most := 0, 0
+	e := &Executor{Objects: noObjects{}, Parallelism: 2, Dispatch: func(req Request) Outcome {
+		mu.Lock()
+		inFlight++
+		if inFlight > most {
+			most = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return Outcome{Status: 200, Body: json.RawMessage(`{"uuid": "1"}`)}
+	}}
+
+	if response := e.Execute(doc, "", nil, true); len(response.Errors) != 0 {
+		t.Fatal(response.Errors)
+	}
+	if most != 2 {
+		t.Fatalf("%d root fields in flight, want 2", most)
+	}
+}
@@ -0,0 +1,581 @@
+package graphql
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"fmt"
+)
+
+/*
+	Document is a parsed GraphQL request document.
+
+	The parser covers the executable part of the GraphQL language: query and mutation operations,
+	variables with defaults, aliases, arguments, fragments (named and inline) and the @include and @skip directives.
+	Type conditions of fragments are not checked, every object type is selected the same way.
+	Spreads of unknown fragments and fragment cycles are rejected.
+ */
+type Document struct {
+	Operations 	[]*Operation
+	Fragments 	map[string]*Fragment
+}
+
+// Operation is a query or mutation
+type Operation struct {
+	Type 		string 		// query or mutation
+	Name 		string
+	Variables 	[]Variable
+	Selections 	[]*Selection
+}
+
+// Variable is a variable definition of an operation. ex: ($uuid: String = "1234")
+type Variable struct {
+	Name 		string
+	Default 	interface{}
+	HasDefault 	bool
+}
+
+// Fragment is a named fragment. ex: fragment names on person { first_name last_name }
+type Fragment struct {
+	Name 		string
+	Selections 	[]*Selection
+}
+
+/*
+	Selection is a field, a fragment spread (Spread) or an inline fragment (Inline).
+
+	Argument values are string, json.Number, bool, nil, Enum, Var, []interface{} or map[string]interface{}.
+ */
+type Selection struct {
+	Alias 		string
+	Name 		string
+	Args 		map[string]interface{}
+	Directives 	map[string]map[string]interface{}
+	Selections 	[]*Selection
+	Spread 		string
+	Inline 		bool
+}
+
+// Key is the name of the field in the response
+func (s *Selection) Key() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+// Var is a variable used as a value. ex: $uuid
+type Var string
+
+// Enum is an enum value, sent to services as a string
+type Enum string
+
+// Error is a GraphQL error, path is the response path of the field that failed
+type Error struct {
+	Message 	string 			`json:"message"`
+	Path 		[]interface{} 		`json:"path,omitempty"`
+	Extensions 	map[string]interface{} 	`json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+const (
+	tokenEOF = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind 	int
+	value 	string
+	pos 	int
+}
+
+type parser struct {
+	src 	string
+	pos 	int
+	tok 	token
+}
+
+// Parse parses a GraphQL request document
+func Parse(src string) (doc *Document, err error) {
+
+	p := &parser{src: src}
+
+	// syntax errors unwind the parser with a panic, recovered here
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, e
+		}
+	}()
+
+	p.next()
+
+	doc = &Document{Fragments: map[string]*Fragment{}}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunct, "{"):
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", Selections: p.selectionSet()})
+		case p.peek(tokenName, "query"), p.peek(tokenName, "mutation"):
+			doc.Operations = append(doc.Operations, p.operation())
+		case p.peek(tokenName, "fragment"):
+			f := p.fragment()
+			if _, ok := doc.Fragments[f.Name]; ok {
+				p.fail("duplicate fragment " + f.Name)
+			}
+			doc.Fragments[f.Name] = f
+		default:
+			p.unexpected()
+		}
+	}
+
+	if len(doc.Operations) == 0 {
+		return nil, &Error{Message: "document has no operation"}
+	}
+	if e := doc.checkFragments(); e != nil {
+		return nil, e
+	}
+
+	return doc, nil
+}
+
+/*
+	checkFragments rejects spreads of unknown fragments and fragments that spread themselves,
+	directly or through other fragments. ex: fragment F on person { account { ...F } }
+	A cycle would expand forever when the selection is executed.
+ */
+func (doc *Document) checkFragments() *Error {
+
+	state := map[string]int{} // 0 = new, 1 = visiting, 2 = done
+
+	var visit func(name string) *Error
+	var walk func(selections []*Selection) *Error
+
+	walk = func(selections []*Selection) *Error {
+		for _, s := range selections {
+			if s.Spread != "" {
+				if _, ok := doc.Fragments[s.Spread]; !ok {
+					return &Error{Message: "unknown fragment " + s.Spread}
+				}
+				if e := visit(s.Spread); e != nil {
+					return e
+				}
+			}
+			if e := walk(s.Selections); e != nil {
+				return e
+			}
+		}
+		return nil
+	}
+
+	visit = func(name string) *Error {
+		switch state[name] {
+		case 1:
+			return &Error{Message: "fragment " + name + " spreads itself"}
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		if e := walk(doc.Fragments[name].Selections); e != nil {
+			return e
+		}
+		state[name] = 2
+		return nil
+	}
+
+	for _, op := range doc.Operations {
+		if e := walk(op.Selections); e != nil {
+			return e
+		}
+	}
+	for name := range doc.Fragments {
+		if e := visit(name); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// Operation returns the operation to run, name is required when the document has several
+func (doc *Document) Operation(name string) (*Operation, error) {
+
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, &Error{Message: "operationName is required when the document has several operations"}
+		}
+		return doc.Operations[0], nil
+	}
+
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+
+	return nil, &Error{Message: "unknown operation " + name}
+}
+
+func (p *parser) operation() *Operation {
+
+	op := &Operation{Type: p.tok.value}
+	p.next()
+
+	if p.tok.kind == tokenName {
+		op.Name = p.name()
+	}
+
+	if p.skip("(") {
+		for !p.skip(")") {
+			p.expect("$")
+			v := Variable{Name: p.name()}
+			p.expect(":")
+			p.typeRef()
+			if p.skip("=") {
+				v.Default, v.HasDefault = p.value(true), true
+			}
+			op.Variables = append(op.Variables, v)
+		}
+	}
+
+	p.directives()
+	op.Selections = p.selectionSet()
+
+	return op
+}
+
+func (p *parser) fragment() *Fragment {
+
+	p.next()
+	f := &Fragment{Name: p.name()}
+	if f.Name == "on" {
+		p.fail("fragment can't be named on")
+	}
+	if !p.peek(tokenName, "on") {
+		p.unexpected()
+	}
+	p.next()
+	p.name()
+	p.directives()
+	f.Selections = p.selectionSet()
+
+	return f
+}
+
+// typeRef skips a variable type. ex: String!, [ID!]
+func (p *parser) typeRef() {
+	if p.skip("[") {
+		p.typeRef()
+		p.expect("]")
+	} else {
+		p.name()
+	}
+	p.skip("!")
+}
+
+func (p *parser) selectionSet() []*Selection {
+
+	p.expect("{")
+
+	var selections []*Selection
+	for !p.skip("}") {
+		selections = append(selections, p.selection())
+	}
+
+	if len(selections) == 0 {
+		p.fail("empty selection set")
+	}
+
+	return selections
+}
+
+func (p *parser) selection() *Selection {
+
+	if p.skip("...") {
+		if p.tok.kind == tokenName && p.tok.value != "on" {
+			s := &Selection{Spread: p.name()}
+			s.Directives = p.directives()
+			return s
+		}
+		if p.peek(tokenName, "on") {
+			p.next()
+			p.name()
+		}
+		s := &Selection{Inline: true}
+		s.Directives = p.directives()
+		s.Selections = p.selectionSet()
+		return s
+	}
+
+	s := &Selection{Name: p.name()}
+	if p.skip(":") {
+		s.Alias, s.Name = s.Name, p.name()
+	}
+
+	s.Args = p.arguments(false)
+	s.Directives = p.directives()
+
+	if p.peek(tokenPunct, "{") {
+		s.Selections = p.selectionSet()
+	}
+
+	return s
+}
+
+func (p *parser) arguments(constant bool) map[string]interface{} {
+
+	if !p.skip("(") {
+		return nil
+	}
+
+	args := map[string]interface{}{}
+	for !p.skip(")") {
+		name := p.name()
+		p.expect(":")
+		args[name] = p.value(constant)
+	}
+
+	return args
+}
+
+func (p *parser) directives() map[string]map[string]interface{} {
+
+	var directives map[string]map[string]interface{}
+	for p.skip("@") {
+		if directives == nil {
+			directives = map[string]map[string]interface{}{}
+		}
+		name := p.name()
+		directives[name] = p.arguments(false)
+	}
+
+	return directives
+}
+
+// value parses an input value, constant values (variable defaults) can't use variables
+func (p *parser) value(constant bool) interface{} {
+
+	tok := p.tok
+
+	switch tok.kind {
+	case tokenInt, tokenFloat:
+		p.next()
+		return json.Number(tok.value)
+	case tokenString:
+		p.next()
+		return tok.value
+	case tokenName:
+		p.next()
+		switch tok.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return Enum(tok.value)
+	}
+
+	switch {
+	case p.skip("$"):
+		if constant {
+			p.fail("variables can't be used in default values")
+		}
+		return Var(p.name())
+	case p.skip("["):
+		list := []interface{}{}
+		for !p.skip("]") {
+			list = append(list, p.value(constant))
+		}
+		return list
+	case p.skip("{"):
+		object := map[string]interface{}{}
+		for !p.skip("}") {
+			name := p.name()
+			p.expect(":")
+			object[name] = p.value(constant)
+		}
+		return object
+	}
+
+	p.unexpected()
+	return nil
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokenName {
+		p.unexpected()
+	}
+	name := p.tok.value
+	p.next()
+	return name
+}
+
+func (p *parser) peek(kind int, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+// skip consumes the punctuator when it is next
+func (p *parser) skip(punct string) bool {
+	if p.peek(tokenPunct, punct) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) {
+	if !p.skip(punct) {
+		p.unexpected()
+	}
+}
+
+func (p *parser) unexpected() {
+	if p.tok.kind == tokenEOF {
+		p.fail("unexpected end of document")
+	}
+	p.fail(fmt.Sprintf("unexpected %q", p.tok.value))
+}
+
+func (p *parser) fail(message string) {
+	line, column := 1, 1
+	for _, c := range p.src[:p.tok.pos] {
+		if c == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	panic(&Error{Message: fmt.Sprintf("syntax error at %d:%d: %s", line, column, message)})
+}
+
+// next reads the next token; white space, commas and comments are ignored
+func (p *parser) next() {
+
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+		} else if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		} else {
+			break
+		}
+	}
+
+	start := p.pos
+	p.tok = token{pos: start}
+
+	if p.pos >= len(p.src) {
+		p.tok.kind = tokenEOF
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok.kind, p.tok.value = tokenPunct, "..."
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		p.pos++
+		p.tok.kind, p.tok.value = tokenPunct, string(c)
+	case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+			p.pos++
+		}
+		p.tok.kind, p.tok.value = tokenName, p.src[start:p.pos]
+	case c == '-' || (c >= '0' && c <= '9'):
+		p.number()
+	case c == '"':
+		p.string()
+	default:
+		p.fail(fmt.Sprintf("unexpected character %q", c))
+	}
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *parser) number() {
+
+	start := p.pos
+	digits := func() {
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+	}
+
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits()
+	p.tok.kind = tokenInt
+
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.pos++
+		digits()
+		p.tok.kind = tokenFloat
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+		p.tok.kind = tokenFloat
+	}
+
+	p.tok.value = p.src[start:p.pos]
+	if _, err := strconv.ParseFloat(p.tok.value, 64); err != nil {
+		p.fail("invalid number " + p.tok.value)
+	}
+}
+
+// string reads a quoted string or a """block string"""
+func (p *parser) string() {
+
+	p.tok.kind = tokenString
+
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			p.fail("unterminated string")
+		}
+		p.tok.value = strings.TrimSpace(p.src[p.pos+3 : p.pos+3+end])
+		p.pos += end + 6
+		return
+	}
+
+	// a GraphQL string is a JSON string, escapes included
+	end := p.pos + 1
+	for end < len(p.src) && p.src[end] != '"' {
+		if p.src[end] == '\\' {
+			end++
+		}
+		if end < len(p.src) && p.src[end] == '\n' {
+			break
+		}
+		end++
+	}
+	if end >= len(p.src) || p.src[end] != '"' {
+		p.fail("unterminated string")
+	}
+
+	if err := json.Unmarshal([]byte(p.src[p.pos:end+1]), &p.tok.value); err != nil {
+		p.fail("invalid string " + p.src[p.pos:end+1])
+	}
+	p.pos = end + 1
+}
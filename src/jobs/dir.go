@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"io/ioutil"
+	"strings"
+	"errors"
+	"sync"
+	"time"
+	"os"
+)
+
+/*
+	Dir keeps every job in a JSON file of a directory, <dir>/<id>.json
+
+	Jobs survive restarts and a directory on a shared volume is shared between gateways.
+	Expired jobs are removed when they are read, and by a sweep of the directory at most once a minute.
+
+	JOBS_DIR: directory of the dir store
+ */
+type Dir struct {
+	Path 	string
+
+	mu 	sync.Mutex
+	swept 	time.Time
+}
+
+// dirFile is the file format, it keeps the fields the API doesn't show
+type dirFile struct {
+	Job
+	Auid 	string 		`json:"auid"`
+	Expires time.Time 	`json:"expires"`
+	Digest 	string 		`json:"digest,omitempty"`
+}
+
+func dirFromEnv() (Store, error) {
+
+	path := os.Getenv("JOBS_DIR")
+	if path == "" {
+		return nil, errors.New("jobs: JOBS_DIR is not set")
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Dir{Path: path}, nil
+}
+
+func (d *Dir) file(id string) string {
+	return filepath.Join(d.Path, filepath.Base(id) + ".json")
+}
+
+func (d *Dir) Put(job Job) error {
+
+	if d.due() {
+		go d.sweep()
+	}
+
+	data, err := json.Marshal(dirFile{Job: job, Auid: job.Auid, Expires: job.Expires, Digest: job.Digest})
+	if err != nil {
+		return err
+	}
+
+	// write and rename so readers never see a partial file
+	tmp := d.file(job.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.file(job.ID))
+}
+
+func (d *Dir) Get(id string) (Job, bool, error) {
+
+	data, err := ioutil.ReadFile(d.file(id))
+	if os.IsNotExist(err) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+
+	var f dirFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return Job{}, false, err
+	}
+
+	job := f.Job
+	job.Auid, job.Expires, job.Digest = f.Auid, f.Expires, f.Digest
+
+	if time.Now().After(job.Expires) {
+		os.Remove(d.file(id))
+		return Job{}, false, nil
+	}
+
+	return job, true, nil
+}
+
+// due reports whether the directory wasn't swept in the last minute, and marks it swept
+func (d *Dir) due() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(d.swept) < time.Minute {
+		return false
+	}
+	d.swept = now
+	return true
+}
+
+// sweep removes the files of expired jobs, the jobs nobody read again
+func (d *Dir) sweep() {
+
+	files, err := ioutil.ReadDir(d.Path)
+	if err != nil {
+		return
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		// Get removes the file when the job expired
+		d.Get(strings.TrimSuffix(f.Name(), ".json"))
+	}
+}
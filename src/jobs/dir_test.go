@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDirSweepRemovesExpiredJobs(t *testing.T) {
+
+	path, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	d := &Dir{Path: path}
+	d.swept = time.Now() // no sweep while the jobs are written
+
+	expired := pendingJob("old", time.Now())
+	expired.Expires = time.Now().Add(-time.Minute)
+	for _, job := range []Job{expired, pendingJob("new", time.Now())} {
+		if err := d.Put(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d.sweep()
+
+	if _, err := os.Stat(d.file("old")); !os.IsNotExist(err) {
+		t.Fatalf("expired job file is still there: %v", err)
+	}
+	if _, found, err := d.Get("new"); err != nil || !found {
+		t.Fatalf("live job: %v, %v", found, err)
+	}
+}
+
+func TestDirKeepsHiddenFields(t *testing.T) {
+
+	path, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	d := &Dir{Path: path}
+	d.swept = time.Now()
+
+	job := pendingJob("w1", time.Now())
+	job.Digest = "abc"
+	if err := d.Put(job); err != nil {
+		t.Fatal(err)
+	}
+
+	got, found, err := d.Get("w1")
+	if err != nil || !found {
+		t.Fatalf("Get: %v, %v", found, err)
+	}
+	if got.Auid != "u1" || got.Digest != "abc" || !got.Expires.Equal(job.Expires) {
+		t.Fatalf("hidden fields = %q %q %v", got.Auid, got.Digest, got.Expires)
+	}
+}
@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job states
+const (
+	Pending = "pending"	// published, no message from the service yet
+	Running = "running"	// the service reported progress
+	Done = "done"		// the service replied with a status below 400
+	Failed = "failed"	// the service replied with an error status or the job timed out
+)
+
+// Job is a request that runs in the background, see Tracker
+type Job struct {
+	ID 		string 		`json:"id"`
+	Status 		string 		`json:"status"`
+	Auid 		string 		`json:"-"`				// owner, only the owner can read the job
+	Object 		string 		`json:"object"`
+	Method 		string 		`json:"method"`
+	Progress 	json.RawMessage `json:"progress,omitempty"`		// body of the last progress message
+	Result 		*models.Reply 	`json:"result,omitempty"`		// reply of the service, set when done or failed
+	Error 		string 		`json:"error,omitempty"`
+	Created 	time.Time 	`json:"created"`
+	Updated 	time.Time 	`json:"updated"`
+	Deadline 	time.Time 	`json:"deadline"`			// the job fails when the service hasn't replied by then
+	Expires 	time.Time 	`json:"-"`				// the job is removed from the store after
+	Digest 		string 		`json:"-"`				// hash of the request of a tracked job, see Tracker.Track
+}
+
+// Finished reports whether the job is done or failed
+func (j *Job) Finished() bool {
+	return j.Status == Done || j.Status == Failed
+}
+
+/*
+	Store keeps jobs between the request that starts them and the requests that read them.
+
+	Implementations must be safe for concurrent use. Jobs are removed once they expire.
+	Stores are selected by name with JOBS_STORE, see Register.
+ */
+type Store interface {
+	Put(job Job) error
+	Get(id string) (Job, bool, error)
+}
+
+// ErrUnknownStore is returned by Open for a name no store was registered with
+var ErrUnknownStore = errors.New("jobs: unknown store")
+
+var (
+	storesMu sync.RWMutex
+	stores = map[string]func() (Store, error){
+		"memory": func() (Store, error) { return NewMemory(), nil },
+		"dir": dirFromEnv,
+	}
+)
+
+// Register makes a store available to JOBS_STORE under name
+func Register(name string, open func() (Store, error)) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	stores[name] = open
+}
+
+// Open creates the store registered with name
+func Open(name string) (Store, error) {
+	storesMu.RLock()
+	open, ok := stores[name]
+	storesMu.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownStore
+	}
+	return open()
+}
+
+// Stores lists the registered store names
+func Stores() []string {
+	storesMu.RLock()
+	defer storesMu.RUnlock()
+
+	names := make([]string, 0, len(stores))
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewID returns a random job id
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
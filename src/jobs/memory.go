@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+)
+
+// Memory keeps jobs in the gateway process. Jobs are lost on restart and not shared between gateways
+type Memory struct {
+	mu 	sync.Mutex
+	jobs 	map[string]Job
+	swept 	time.Time
+}
+
+// NewMemory creates an empty memory store
+func NewMemory() *Memory {
+	return &Memory{jobs: map[string]Job{}}
+}
+
+func (m *Memory) Put(job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep()
+	m.jobs[job.ID] = job
+
+	return nil
+}
+
+func (m *Memory) Get(id string) (Job, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if ok && time.Now().After(job.Expires) {
+		delete(m.jobs, id)
+		return Job{}, false, nil
+	}
+
+	return job, ok, nil
+}
+
+// sweep removes expired jobs, at most once a minute. lock held
+func (m *Memory) sweep() {
+
+	now := time.Now()
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+
+	for id, job := range m.jobs {
+		if now.After(job.Expires) {
+			delete(m.jobs, id)
+		}
+	}
+}
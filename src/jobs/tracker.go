@@ -0,0 +1,323 @@
+package jobs
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/codec"
+	"github.com/nats-io/nats.go"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+	"log"
+	"os"
+)
+
+/*
+	Tracker runs requests as jobs, for methods that take longer than the request timeout.
+
+	The request is published with the reply subject <Subject>.<job id> and the header Job-Id, so a service
+	that simply responds to the message completes the job. Services can report progress before that by
+	publishing to the reply subject with the header Job-Status: running, the body is kept as the progress.
+	Replies are read like any other reply (Status header or binary envelope), a status of 400 or more fails the job.
+
+	Every gateway listens on <Subject>.>, replies for jobs that are not in its store are ignored.
+	Use a shared store when several gateways run. Updates of a job are serialized, see update.
+
+	JOBS_STORE: name of the store, memory (default) or dir (JOBS_DIR), see Register
+	JOBS_SUBJECT: subject prefix of the replies. Default = gateway.jobs
+	JOBS_TIMEOUT: time the service has to complete a job. Default = 1h
+	JOBS_TTL: time a job is kept after it was started. Default = 24h
+ */
+type Tracker struct {
+	Store 		Store
+	Subject 	string
+	Timeout 	time.Duration
+	TTL 		time.Duration
+
+	mu 		sync.Mutex
+	nc 		*nats.Conn
+	locks 		[64]sync.Mutex 	// serialize the updates of a job, by hash of its id
+}
+
+// ErrDigest is returned by Track when the id of the job was tracked for a different request
+var ErrDigest = errors.New("jobs: id was used for a different request")
+
+// FromEnv creates the tracker from the JOBS_* variables
+func FromEnv() *Tracker {
+
+	t := &Tracker{
+		Subject: os.Getenv("JOBS_SUBJECT"),
+		Timeout: duration("JOBS_TIMEOUT", time.Hour),
+		TTL: duration("JOBS_TTL", 24*time.Hour),
+	}
+	if t.Subject == "" {
+		t.Subject = "gateway.jobs"
+	}
+
+	name := os.Getenv("JOBS_STORE")
+	if name == "" {
+		name = "memory"
+	}
+	store, err := Open(name)
+	if err != nil {
+		log.Println(">>> ERROR: JOBS_STORE " + name + " - ", err)
+		store = NewMemory()
+	}
+	t.Store = store
+
+	return t
+}
+
+func duration(name string, fallback time.Duration) time.Duration {
+	if val := os.Getenv(name); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			return d
+		}
+		log.Println(">>> ERROR: " + name + " is not a duration")
+	}
+	return fallback
+}
+
+// Start publishes the message to the service subject and stores the pending job
+func (t *Tracker) Start(auid string, object string, method string, subject string, contentType string, message []byte) (Job, error) {
+
+	if err := t.connect(); err != nil {
+		return Job{}, err
+	}
+
+	now := time.Now().UTC()
+	job := Job{
+		ID: NewID(),
+		Status: Pending,
+		Auid: auid,
+		Object: object,
+		Method: method,
+		Created: now,
+		Updated: now,
+		Deadline: now.Add(t.Timeout),
+		Expires: now.Add(t.TTL),
+	}
+
+	// stored first, the reply can't arrive before the job exists
+	if err := t.Store.Put(job); err != nil {
+		return Job{}, err
+	}
+
+	request := nats.NewMsg(subject)
+	request.Header.Set(codec.ContentTypeHeader, contentType)
+	request.Header.Set("Job-Id", job.ID)
+	request.Reply = t.ReplySubject(job.ID)
+	request.Data = message
+
+	if err := t.nc.PublishMsg(request); err != nil {
+		return Job{}, err
+	}
+	if err := t.nc.Flush(); err != nil {
+		return Job{}, err
+	}
+
+	return job, nil
+}
+
+/*
+	Track stores a pending job for a request that is published elsewhere, ex: a durable write, and returns it.
+	An existing job with the id is returned as it is, with existed set. The reply is expected on ReplySubject(id)
+	until the job expires, the request may wait for a service that is down.
+
+	digest identifies the content of the request. An existing job that was tracked for another digest
+	fails with ErrDigest, the id was reused for a different request.
+ */
+func (t *Tracker) Track(id string, auid string, object string, method string, digest string) (job Job, existed bool, err error) {
+
+	job, existed, err = t.Store.Get(id)
+	if err != nil {
+		return Job{}, false, err
+	}
+	if existed && job.Digest != digest {
+		return Job{}, true, ErrDigest
+	}
+
+	if err := t.connect(); err != nil {
+		return Job{}, false, err
+	}
+	if existed {
+		return job, true, nil
+	}
+
+	now := time.Now().UTC()
+	job = Job{
+		ID: id,
+		Status: Pending,
+		Auid: auid,
+		Object: object,
+		Method: method,
+		Created: now,
+		Updated: now,
+		Deadline: now.Add(t.TTL),
+		Expires: now.Add(t.TTL),
+		Digest: digest,
+	}
+
+	return job, false, t.Store.Put(job)
+}
+
+/*
+	Restart resets a finished job to pending, for a request that was published again.
+
+	job is the job as it was read before the request was published. When the stored job changed since
+	(the service already replied to the new request) it is returned as it is.
+ */
+func (t *Tracker) Restart(job Job) (Job, error) {
+
+	if job.Finished() == false {
+		return job, nil
+	}
+
+	restarted, _, err := t.update(job.ID, func(stored *Job) bool {
+		if stored.Updated.Equal(job.Updated) == false {
+			return false
+		}
+
+		now := time.Now().UTC()
+		stored.Status = Pending
+		stored.Progress = nil
+		stored.Result = nil
+		stored.Error = ""
+		stored.Updated = now
+		stored.Deadline = now.Add(t.TTL)
+		stored.Expires = now.Add(t.TTL)
+		return true
+	})
+
+	return restarted, err
+}
+
+// ReplySubject is the subject the service replies to for the job
+func (t *Tracker) ReplySubject(id string) string {
+	return t.Subject + "." + id
+}
+
+// Get returns the job of the user, jobs past their deadline are failed
+func (t *Tracker) Get(id string, auid string) (Job, bool, error) {
+
+	job, ok, err := t.Store.Get(id)
+	if err != nil || !ok || job.Auid != auid {
+		return Job{}, false, err
+	}
+
+	if !job.Finished() && time.Now().After(job.Deadline) {
+		// checked again under the lock, a reply may have completed the job since
+		job, ok, err = t.update(id, func(stored *Job) bool {
+			if stored.Finished() {
+				return false
+			}
+			stored.Status = Failed
+			stored.Error = "the service didn't complete the job in time"
+			stored.Updated = time.Now().UTC()
+			return true
+		})
+		if err != nil || !ok {
+			return Job{}, false, err
+		}
+	}
+
+	return job, true, nil
+}
+
+/*
+	update reads the job, applies change and stores the job when change reports it changed it.
+
+	Updates of the same job are serialized, so a reply and a deadline that land together can't overwrite each other.
+	Returns the job as stored, ok is false when there is no job with the id.
+ */
+func (t *Tracker) update(id string, change func(job *Job) bool) (Job, bool, error) {
+
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	lock := &t.locks[h.Sum32() % uint32(len(t.locks))]
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	job, ok, err := t.Store.Get(id)
+	if err != nil || !ok {
+		return Job{}, ok, err
+	}
+
+	if change(&job) {
+		if err := t.Store.Put(job); err != nil {
+			return Job{}, false, err
+		}
+	}
+
+	return job, true, nil
+}
+
+// connect opens the connection and the reply subscription the first time
+func (t *Tracker) connect() error {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.nc != nil {
+		return nil
+	}
+
+	// Connect to NATS server; reconnect forever
+	nc, err := nats.Connect(os.Getenv("NATS_URI"), nats.MaxReconnects(-1))
+	if err != nil {
+		return err
+	}
+
+	if _, err := nc.Subscribe(t.Subject + ".>", t.complete); err != nil {
+		nc.Close()
+		return err
+	}
+
+	t.nc = nc
+	return nil
+}
+
+// complete records a progress or reply message of a job
+func (t *Tracker) complete(msg *nats.Msg) {
+
+	id := strings.TrimPrefix(msg.Subject, t.Subject + ".")
+
+	_, _, err := t.update(id, func(job *Job) bool {
+		if job.Finished() {
+			return false
+		}
+
+		job.Updated = time.Now().UTC()
+
+		if msg.Header != nil && msg.Header.Get("Job-Status") == Running {
+			job.Status = Running
+			if json.Valid(msg.Data) {
+				job.Progress = msg.Data
+			}
+			return true
+		}
+
+		reply, err := codec.ReadReply(msg)
+		if err != nil {
+			job.Status = Failed
+			job.Error = err.Error()
+			return true
+		}
+
+		// the job is served as JSON, other bodies are kept as a string
+		if len(reply.Body) > 0 && !json.Valid(reply.Body) {
+			reply.Body, _ = json.Marshal(string(reply.Body))
+		}
+		job.Result = &reply
+		job.Status = Done
+		if reply.Status >= 400 {
+			job.Status = Failed
+		}
+		return true
+	})
+	if err != nil {
+		log.Println(">>> ERROR: Job " + id + " - ", err)
+	}
+}
@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"github.com/nats-io/nats.go"
+	"testing"
+	"time"
+)
+
+// hookStore runs before once, the first time a job is read
+type hookStore struct {
+	Store
+	before func()
+}
+
+func (h *hookStore) Get(id string) (Job, bool, error) {
+	if before := h.before; before != nil {
+		h.before = nil
+		before()
+	}
+	return h.Store.Get(id)
+}
+
+func pendingJob(id string, deadline time.Time) Job {
+	now := time.Now().UTC()
+	return Job{ID: id, Status: Pending, Auid: "u1", Created: now, Updated: now, Deadline: deadline, Expires: now.Add(time.Hour)}
+}
+
+func TestReplyAtTheDeadlineIsKept(t *testing.T) {
+
+	store := &hookStore{Store: NewMemory()}
+	tracker := &Tracker{Store: store, Subject: "gateway.jobs", TTL: time.Hour}
+	store.Put(pendingJob("j1", time.Now().Add(-time.Second)))
+
+	// the reply lands after Get read the job past its deadline, before Get fails it
+	store.before = func() {
+		tracker.complete(&nats.Msg{Subject: "gateway.jobs.j1", Data: []byte(`{"ok": true}`)})
+	}
+
+	job, found, err := tracker.Get("j1", "u1")
+	if err != nil || !found {
+		t.Fatal(found, err)
+	}
+	if job.Status != Done {
+		t.Fatalf("status = %s, want %s", job.Status, Done)
+	}
+
+	stored, _, _ := store.Get("j1")
+	if stored.Status != Done || stored.Result == nil {
+		t.Fatalf("stored job = %+v", stored)
+	}
+}
+
+func TestGetFailsJobsPastTheirDeadline(t *testing.T) {
+
+	tracker := &Tracker{Store: NewMemory(), Subject: "gateway.jobs", TTL: time.Hour}
+	tracker.Store.Put(pendingJob("j1", time.Now().Add(-time.Second)))
+
+	job, found, err := tracker.Get("j1", "u1")
+	if err != nil || !found || job.Status != Failed {
+		t.Fatalf("job = %+v, %v, %v", job, found, err)
+	}
+
+	// late replies don't change a failed job
+	tracker.complete(&nats.Msg{Subject: "gateway.jobs.j1", Data: []byte(`{}`)})
+	if job, _, _ := tracker.Get("j1", "u1"); job.Status != Failed {
+		t.Fatalf("status = %s after a late reply", job.Status)
+	}
+
+	if _, found, _ := tracker.Get("j1", "u2"); found {
+		t.Fatal("another user read the job")
+	}
+}
+
+func TestRestartKeepsANewerReply(t *testing.T) {
+
+	tracker := &Tracker{Store: NewMemory(), Subject: "gateway.jobs", TTL: time.Hour}
+	done := pendingJob("j1", time.Now().Add(time.Hour))
+	done.Status = Done
+	tracker.Store.Put(done)
+
+	// the service replied to the republished write before Restart ran
+	newer := done
+	newer.Updated = done.Updated.Add(time.Millisecond)
+	newer.Error = "newer"
+	tracker.Store.Put(newer)
+
+	job, err := tracker.Restart(done)
+	if err != nil || job.Status != Done || job.Error != "newer" {
+		t.Fatalf("job = %+v, %v", job, err)
+	}
+
+	// without a newer reply the job is pending again
+	job, err = tracker.Restart(job)
+	if err != nil || job.Status != Pending || job.Error != "" {
+		t.Fatalf("job = %+v, %v", job, err)
+	}
+}
+
+func TestTrackRejectsOtherDigest(t *testing.T) {
+
+	store := NewMemory()
+	tracker := &Tracker{Store: store, Subject: "gateway.jobs", TTL: time.Hour}
+	job := pendingJob("w1", time.Now().Add(time.Hour))
+	job.Digest = "a"
+	store.Put(job)
+
+	// checked before connecting, a conflicting request is never published
+	if _, existed, err := tracker.Track("w1", "u1", "ledger", "post", "b"); err != ErrDigest || !existed {
+		t.Fatalf("Track with another digest = %v %v, want ErrDigest", existed, err)
+	}
+}
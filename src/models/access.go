@@ -2,7 +2,10 @@ package models
 
 import (
 	"log"
+	"mime"
+	"time"
 	"strings"
+	"encoding/json"
 	"encoding/base64"
 )
 
@@ -94,6 +97,60 @@ func (uc Authorize) VerifyUploadHeader(header map[string][]string) bool {
 	}
 }
 
+// PatchTypes are the content types accepted for PATCH bodies. application/json is treated as a merge patch
+var PatchTypes = []string{"application/merge-patch+json", "application/json-patch+json", "application/json"}
+
+func (uc Authorize) VerifyPatchHeader(header map[string][]string) bool {
+
+	// make sure content type has been set
+	if val, ok := header["Content-Type"]; ok {
+
+		// make sure content type is a patch document
+		if isPatchType(val[0]) {
+
+			// make sure Authorization has been set
+			if _, ok := header["Authorization"]; ok {
+
+				// make sure Key has been set
+				if _, ok := header["Key"]; ok {
+
+					return true // everything was set correctly
+
+				} else {
+					log.Println("Key is missing")
+					return false
+				}
+
+			} else {
+				log.Println("Authorization is missing")
+				return false
+			}
+
+		} else {
+			log.Println("Incorrect Content Type")
+			return false
+		}
+
+	} else {
+		log.Println("Missing Content Type")
+		return false
+	}
+}
+
+// isPatchType reports whether the media type is a patch type, parameters (ex: charset) are ignored
+func isPatchType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, patchType := range PatchTypes {
+		if mediaType == patchType {
+			return true
+		}
+	}
+	return false
+}
+
 func (uc Authorize) VerifyToken(header map[string][]string) bool {
 
 
@@ -128,6 +185,39 @@ func (uc Authorize) VerifyToken(header map[string][]string) bool {
 
 }
 
+// TokenExpiry reads the exp claim of the token, from its header or its payload. ok is false when the token has none
+func (uc Authorize) TokenExpiry(header map[string][]string) (time.Time, bool) {
+
+	val, ok := header["Authorization"]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	// decode token the way VerifyToken does
+	rawtoken, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(val[0], "Bearer "))
+	if err != nil {
+		return time.Time{}, false
+	}
+	token := strings.TrimSuffix(string(rawtoken), ":")
+
+	// header.payload.signature, the first two segments are base64url JSON
+	segments := strings.Split(token, ".")
+	for i := 0; i < len(segments) && i < 2; i++ {
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[i], "="))
+		if err != nil {
+			continue
+		}
+		var claims struct {
+			Exp float64 `json:"exp"`
+		}
+		if json.Unmarshal(data, &claims) == nil && claims.Exp > 0 {
+			return time.Unix(int64(claims.Exp), 0), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
 func (uc Authorize) VerifyKey(header map[string][]string) (*User, bool) {
 
 	if val, ok := header["Key"]; ok {
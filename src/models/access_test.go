@@ -0,0 +1,23 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestVerifyPatchHeader(t *testing.T) {
+
+	for contentType, want := range map[string]bool{
+		"application/merge-patch+json": true,
+		"application/merge-patch+json; charset=utf-8": true,
+		"application/json-patch+json;charset=UTF-8": true,
+		"Application/JSON; charset=utf-8": true,
+		"application/xml": false,
+		"application/merge-patch+json; charset": false,
+		"": false,
+	} {
+		header := map[string][]string{"Content-Type": {contentType}, "Authorization": {"token"}, "Key": {"key"}}
+		if got := (Authorize{}).VerifyPatchHeader(header); got != want {
+			t.Errorf("VerifyPatchHeader(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
@@ -1,5 +1,12 @@
 package models
 
+import (
+	"encoding/json"
+	"strconv"
+	"errors"
+	"fmt"
+)
+
 // This struct standardizes / normalizes the message payload
 type MessagePayload struct {
 	Auid 		string `json:"auid"`	// UUID of person making request (authorized UUID)
@@ -14,4 +21,93 @@ type MessagePayload struct {
 	Http_method 	string `json:"http_method"`  // GET, POST, PUT, DELETE - tell service what request method was used
 	Method 		string `json:"method"` 	// Methods are the function that will process the request
 	Version 	string `json:"version"` // Version of service requested
-}
\ No newline at end of file
+	Params 		map[string][]string `json:"params,omitempty"`	// every URL param of the request <method?key=value>
+	Headers 	map[string]string `json:"headers,omitempty"`	// allow listed HTTP request headers. ex: Accept-Language
+	Query 		*Query `json:"query,omitempty"`	// parsed filter, sort and fields params
+	Cursor 		string `json:"cursor,omitempty"`	// marker the service returned for the requested page (cursor paging)
+}
+
+// Paging defaults and bounds of the version 2 message payload
+const (
+	DefaultResults = 25
+	MaxResults = 100
+)
+
+// Version 2 of the message payload. Body is a JSON object instead of a JSON string and paging is numeric
+type MessagePayloadV2 struct {
+	SchemaVersion 	int 		`json:"schema_version"`	// payload schema version, always 2
+	Auid 		string 		`json:"auid"`	// UUID of person making request (authorized UUID)
+	Uuid 		string 		`json:"uuid"`	// UUID of object were referring to
+	Object 		string 		`json:"object"` 	// object type were referring to. Usually mapped to the service
+	Key 		string 		`json:"key"`		// key used for search
+	Keyword 	string 		`json:"keyword"`	// value used for search
+	Body 		json.RawMessage `json:"body,omitempty"`	// Message Body JSON object {key:value, key:value}
+	Perspective 	string 		`json:"perspective"`	// perspective were making the query from. ex: admin, superadmin, etc
+	Results 	int 		`json:"results"`	// qty of objects returned. 1 - MaxResults, default DefaultResults
+	Page 		int 		`json:"page"`	// page were results start. starts at 1
+	Http_method 	string 		`json:"http_method"`  // GET, POST, PUT, DELETE - tell service what request method was used
+	Method 		string 		`json:"method"` 	// Methods are the function that will process the request
+	Version 	string 		`json:"version"` // Version of service requested
+	Params 		map[string][]string `json:"params,omitempty"`	// every URL param of the request <method?key=value>
+	Headers 	map[string]string `json:"headers,omitempty"`	// allow listed HTTP request headers. ex: Accept-Language
+	Query 		*Query `json:"query,omitempty"`	// parsed filter, sort and fields params
+	Cursor 		string `json:"cursor,omitempty"`	// marker the service returned for the requested page (cursor paging)
+}
+
+// V2 converts the payload to version 2, paging values are validated and defaulted
+func (mp MessagePayload) V2() (MessagePayloadV2, error) {
+
+	results, page, err := Paging(mp.Results, mp.Page)
+	if err != nil {
+		return MessagePayloadV2{}, err
+	}
+
+	var body json.RawMessage
+	if mp.Body != "" {
+		body = json.RawMessage(mp.Body)
+	}
+
+	return MessagePayloadV2{
+		SchemaVersion: 2,
+		Auid: mp.Auid,
+		Uuid: mp.Uuid,
+		Object: mp.Object,
+		Key: mp.Key,
+		Keyword: mp.Keyword,
+		Body: body,
+		Perspective: mp.Perspective,
+		Results: results,
+		Page: page,
+		Http_method: mp.Http_method,
+		Method: mp.Method,
+		Version: mp.Version,
+		Params: mp.Params,
+		Headers: mp.Headers,
+		Query: mp.Query,
+		Cursor: mp.Cursor,
+	}, nil
+}
+
+// Paging parses the results and page URL params. Empty values get the defaults
+func Paging(results string, page string) (int, int, error) {
+
+	r, p := DefaultResults, 1
+
+	if results != "" {
+		n, err := strconv.Atoi(results)
+		if err != nil || n < 1 || n > MaxResults {
+			return 0, 0, fmt.Errorf("results must be a number between 1 and %d", MaxResults)
+		}
+		r = n
+	}
+
+	if page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return 0, 0, errors.New("page must be a number greater than 0")
+		}
+		p = n
+	}
+
+	return r, p, nil
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"net/url"
+	"strings"
+	"errors"
+	"regexp"
+	"sort"
+	"fmt"
+)
+
+/*
+	Query is the structured form of the filter, sort and field selection URL params.
+
+	filter[<field>][<operator>]=<value>	ex: filter[name][eq]=Steve, filter[age][gte]=21
+	filter[<field>]=<value>			shorthand for eq
+	filter[<field>][in]=<a>,<b>		in and nin take a comma separated list
+	sort=<field>,-<field>			- sorts descending. ex: sort=-created,name
+	fields=<field>,<field>			fields returned. ex: fields=name,email
+
+	Field names are letters, digits and underscores; dots select nested fields. ex: address.zip
+ */
+type Query struct {
+	Filters 	[]Filter 	`json:"filters,omitempty" msgpack:"filters,omitempty"`
+	Sort 		[]Sort 		`json:"sort,omitempty" msgpack:"sort,omitempty"`
+	Fields 		[]string 	`json:"fields,omitempty" msgpack:"fields,omitempty"`
+}
+
+// Filter is a single filter condition
+type Filter struct {
+	Field 		string 		`json:"field" msgpack:"field"`
+	Operator 	string 		`json:"op" msgpack:"op"`				// see Operators
+	Value 		string 		`json:"value,omitempty" msgpack:"value,omitempty"`	// value of every operator but in and nin
+	Values 		[]string 	`json:"values,omitempty" msgpack:"values,omitempty"`	// values of in and nin
+}
+
+// Sort is a single sort field
+type Sort struct {
+	Field 		string 		`json:"field" msgpack:"field"`
+	Descending 	bool 		`json:"desc,omitempty" msgpack:"desc,omitempty"`
+}
+
+// Operators are the filter operators services must support
+var Operators = []string{"eq", "ne", "gt", "gte", "lt", "lte", "in", "nin", "like", "exists"}
+
+// Limits of a single query
+const (
+	MaxFilters = 20
+	MaxSortFields = 5
+	MaxFields = 50
+)
+
+var (
+	fieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+	filterParam = regexp.MustCompile(`^filter\[([^\[\]]*)\](?:\[([^\[\]]*)\])?$`)
+)
+
+/*
+	ParseQuery parses the filter, sort and fields URL params.
+
+	Returns nil when none of them were sent. The error explains what is malformed and can be returned to the client.
+ */
+func ParseQuery(params url.Values) (*Query, error) {
+
+	query := &Query{}
+	found := false
+
+	// walk params in order so filters are stable
+	names := make([]string, 0, len(params))
+	for param := range params {
+		names = append(names, param)
+	}
+	sort.Strings(names)
+
+	for _, param := range names {
+
+		values := params[param]
+
+		switch {
+
+		case param == "sort":
+			found = true
+			for _, field := range splitList(values) {
+				descending := strings.HasPrefix(field, "-")
+				field = strings.TrimPrefix(field, "-")
+				if !fieldName.MatchString(field) {
+					return nil, fmt.Errorf("sort: invalid field name %q", field)
+				}
+				query.Sort = append(query.Sort, Sort{Field: field, Descending: descending})
+			}
+			if len(query.Sort) == 0 {
+				return nil, errors.New("sort: no fields given")
+			}
+
+		case param == "fields":
+			found = true
+			for _, field := range splitList(values) {
+				if !fieldName.MatchString(field) {
+					return nil, fmt.Errorf("fields: invalid field name %q", field)
+				}
+				query.Fields = append(query.Fields, field)
+			}
+			if len(query.Fields) == 0 {
+				return nil, errors.New("fields: no fields given")
+			}
+
+		case param == "filter" || strings.HasPrefix(param, "filter["):
+			found = true
+			match := filterParam.FindStringSubmatch(param)
+			if match == nil {
+				return nil, fmt.Errorf("%s: filters must be written filter[<field>][<operator>]=<value>", param)
+			}
+
+			field, operator := match[1], match[2]
+			if !fieldName.MatchString(field) {
+				return nil, fmt.Errorf("%s: invalid field name %q", param, field)
+			}
+			if operator == "" {
+				operator = "eq"
+			}
+			if !validOperator(operator) {
+				return nil, fmt.Errorf("%s: unknown operator %q, use one of %s", param, operator, strings.Join(Operators, ", "))
+			}
+
+			for _, value := range values {
+				filter := Filter{Field: field, Operator: operator}
+				switch operator {
+				case "in", "nin":
+					filter.Values = splitList([]string{value})
+					if len(filter.Values) == 0 {
+						return nil, fmt.Errorf("%s: needs a comma separated list of values", param)
+					}
+				case "exists":
+					if value != "true" && value != "false" {
+						return nil, fmt.Errorf("%s: value must be true or false", param)
+					}
+					filter.Value = value
+				default:
+					filter.Value = value
+				}
+				query.Filters = append(query.Filters, filter)
+			}
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	if len(query.Filters) > MaxFilters {
+		return nil, fmt.Errorf("filter: at most %d filters are allowed", MaxFilters)
+	}
+	if len(query.Sort) > MaxSortFields {
+		return nil, fmt.Errorf("sort: at most %d fields are allowed", MaxSortFields)
+	}
+	if len(query.Fields) > MaxFields {
+		return nil, fmt.Errorf("fields: at most %d fields are allowed", MaxFields)
+	}
+
+	return query, nil
+}
+
+func validOperator(operator string) bool {
+	for _, op := range Operators {
+		if op == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits comma separated values and drops empty entries
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
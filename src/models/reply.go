@@ -0,0 +1,12 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// This struct standardizes the reply envelope services send back with binary encodings
+type Reply struct {
+	Status 		int 			`json:"status"`			// HTTP status the gateway responds with. 0 = 200
+	Headers 	map[string]string 	`json:"headers,omitempty"`	// HTTP headers added to the response
+	Body 		json.RawMessage 	`json:"body"`			// Response Object, a JSON document
+}
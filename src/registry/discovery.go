@@ -0,0 +1,145 @@
+package registry
+
+import (
+	"github.com/nats-io/nats.go"
+	"encoding/json"
+	"time"
+	"log"
+)
+
+// DefaultTTL is how long an announcement is valid when the service doesn't send its own ttl
+const DefaultTTL = 30*time.Second
+
+/*
+	Announce registers or refreshes a service that announced itself on the discovery subject.
+
+	The announcement expires after its ttl (seconds) or DefaultTTL, services are expected to
+	announce themselves again (heartbeat) before it does. A configured service keeps its subject
+	and never expires, the announcement only updates its versions, methods and schema hash.
+ */
+func (r *Registry) Announce(service Service) error {
+
+	if err := ValidObject(service.Object); err != nil {
+		return err
+	}
+	if service.Subject == "" {
+		service.Subject = service.Object
+	}
+	if err := ValidSubject(service.Subject); err != nil {
+		return err
+	}
+	if err := ValidPayload(service.Payload); err != nil {
+		return err
+	}
+	if err := ValidEncoding(service.Encoding); err != nil {
+		return err
+	}
+
+	ttl := DefaultTTL
+	if service.TTL > 0 {
+		ttl = time.Duration(service.TTL) * time.Second
+	}
+	expires := time.Now().Add(ttl)
+	service.Expires = &expires
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// configured services are never replaced by announcements
+	if current, ok := r.services[service.Object]; ok && current.Expires == nil {
+		updated := *current
+		updated.Versions = service.Versions
+		updated.Methods = service.Methods
+		updated.SchemaHash = service.SchemaHash
+		updated.Schemas = service.Schemas
+		updated.Streaming = service.Streaming
+		if service.Durable {
+			updated.Durable = true
+		}
+		if len(service.HTTPMethods) > 0 {
+			updated.HTTPMethods = service.HTTPMethods
+		}
+		if service.Payload != "" {
+			updated.Payload = service.Payload
+		}
+		if service.Encoding != "" {
+			updated.Encoding = service.Encoding
+		}
+		r.services[service.Object] = &updated
+		return nil
+	}
+
+	if _, ok := r.services[service.Object]; !ok {
+		log.Println("Service discovered: " + service.Object + " on " + service.Subject)
+	}
+	r.services[service.Object] = &service
+
+	return nil
+}
+
+// Sweep removes every announced service whose heartbeat expired
+func (r *Registry) Sweep() {
+
+	r.mu.Lock()
+	var expired []Service
+	now := time.Now()
+	for object, service := range r.services {
+		if service.expired(now) {
+			log.Println("Service expired: " + object)
+			expired = append(expired, *service)
+			delete(r.services, object)
+		}
+	}
+	r.mu.Unlock()
+
+	if r.Expired != nil {
+		for _, service := range expired {
+			r.Expired(service)
+		}
+	}
+}
+
+/*
+	Listen subscribes to the discovery subject and keeps the registry up to date.
+
+	Announcements are JSON encoded Service definitions. ex:
+	{"object": "person", "subject": "person", "versions": ["V1"], "methods": ["get", "create"], "schema_hash": "9f86d0", "ttl": 30,
+	 "schemas": {"create": {"type": "object", "required": ["name"]}}}
+
+	Expired services are swept every interval until the subscription is closed.
+ */
+func (r *Registry) Listen(natsConnection *nats.Conn, subject string, interval time.Duration) (*nats.Subscription, error) {
+
+	sub, err := natsConnection.Subscribe(subject, func(msg *nats.Msg) {
+
+		var service Service
+		if err := json.Unmarshal(msg.Data, &service); err != nil {
+			log.Println(">>> ERROR: Discovery Announcement error - ", err)
+			return
+		}
+		if err := r.Announce(service); err != nil {
+			log.Println(">>> ERROR: Discovery Announcement error - ", err)
+			return
+		}
+		if r.Announced != nil {
+			r.Announced(service)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if !sub.IsValid() {
+				return
+			}
+			r.Sweep()
+		}
+	}()
+
+	return sub, nil
+}
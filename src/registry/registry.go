@@ -0,0 +1,288 @@
+package registry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"log"
+	"os"
+)
+
+/*
+	Registry is the list of objects (micro services) the gateway is allowed to publish to.
+
+	The :object route param is never used verbatim as a NATS subject. It is looked up in the registry
+	and requests for unknown objects are rejected with 404 instead of waiting for the request timeout.
+
+	SERVICES: comma separated list of <object> or <object>:<subject>. ex: person,account:svc.account
+	SERVICES_FILE: path to a JSON file with a list of Service definitions
+
+	Services can also announce themselves on the discovery subject, see Listen.
+	Configured services never expire, announced services expire when their heartbeat stops.
+ */
+type Registry struct {
+	mu 		sync.RWMutex
+	services 	map[string]*Service
+
+	// Announced is called after every accepted discovery announcement
+	Announced 	func(service Service)
+
+	// Expired is called for every announced service Sweep removes
+	Expired 	func(service Service)
+}
+
+// Service maps an object to the NATS subject of the micro service that handles it
+type Service struct {
+	Object 		string 		`json:"object"`			// object name used in the URL
+	Subject 	string 		`json:"subject,omitempty"`	// NATS subject. Default = object
+	Versions 	[]string 	`json:"versions,omitempty"`	// versions the service supports. ex: V1, V2
+	Methods 	[]string 	`json:"methods,omitempty"`	// methods the service supports. ex: get, list, create
+	SchemaHash 	string 		`json:"schema_hash,omitempty"`	// hash of the schemas the service validates against
+	Schemas 	map[string]json.RawMessage `json:"schemas,omitempty"`	// request JSON Schemas by <method> or <method>@<version>
+	Payload 	string 		`json:"payload,omitempty"`	// message payload encoding the service reads: v1 (default) or v2
+	Encoding 	string 		`json:"encoding,omitempty"`	// wire encoding: json (default), msgpack or protobuf. binary encodings use payload v2
+	HTTPMethods 	[]string 	`json:"http_methods,omitempty"`	// HTTP methods the object accepts. Default = every method
+	Streaming 	[]string 	`json:"streaming,omitempty"`	// methods that reply with a stream of chunks. ex: export
+	Durable 	bool 		`json:"durable,omitempty"`	// writes are stored in a JetStream stream, see durable.Writer
+	TTL 		int 		`json:"ttl,omitempty"`		// seconds an announcement is valid for
+	Expires 	*time.Time 	`json:"expires,omitempty"`	// nil for configured services
+}
+
+// New creates an empty registry
+func New() *Registry {
+	return &Registry{services: map[string]*Service{}}
+}
+
+// FromEnv creates a registry from SERVICES_FILE and SERVICES
+func FromEnv() *Registry {
+
+	r := New()
+
+	if path := os.Getenv("SERVICES_FILE"); path != "" {
+		if err := r.LoadFile(path); err != nil {
+			log.Println(">>> ERROR: SERVICES_FILE - ", err)
+		}
+	}
+
+	for _, entry := range strings.Split(os.Getenv("SERVICES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		service := Service{Object: parts[0]}
+		if len(parts) == 2 {
+			service.Subject = parts[1]
+		}
+		if err := r.Register(service); err != nil {
+			log.Println(">>> ERROR: SERVICES - ", err)
+		}
+	}
+
+	return r
+}
+
+// LoadFile registers every service defined in a JSON file
+func (r *Registry) LoadFile(path string) error {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var services []Service
+	if err := json.Unmarshal(data, &services); err != nil {
+		return err
+	}
+
+	for _, service := range services {
+		if err := r.Register(service); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Register validates the service and adds it to the registry, replacing any previous definition
+func (r *Registry) Register(service Service) error {
+
+	if err := ValidObject(service.Object); err != nil {
+		return err
+	}
+	if service.Subject == "" {
+		service.Subject = service.Object
+	}
+	if err := ValidSubject(service.Subject); err != nil {
+		return err
+	}
+	if err := ValidPayload(service.Payload); err != nil {
+		return err
+	}
+	if err := ValidEncoding(service.Encoding); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.services[service.Object] = &service
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Remove deletes the object from the registry
+func (r *Registry) Remove(object string) {
+	r.mu.Lock()
+	delete(r.services, object)
+	r.mu.Unlock()
+}
+
+// Lookup returns the service registered for the object. Expired services are not returned
+func (r *Registry) Lookup(object string) (*Service, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	service, ok := r.services[object]
+	if !ok || service.expired(time.Now()) {
+		return nil, false
+	}
+	return service, true
+}
+
+// List returns a copy of every live service ordered by object name
+func (r *Registry) List() []Service {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	list := make([]Service, 0, len(r.services))
+	for _, service := range r.services {
+		if !service.expired(now) {
+			list = append(list, *service)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Object < list[j].Object })
+
+	return list
+}
+
+// DefaultHTTPMethods are the HTTP methods of a service that doesn't list its own
+var DefaultHTTPMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// Allow returns the HTTP methods the object accepts. HEAD is allowed with GET, OPTIONS always is
+func (s *Service) Allow() []string {
+
+	if len(s.HTTPMethods) == 0 {
+		return DefaultHTTPMethods
+	}
+
+	allow := []string{}
+	for _, method := range DefaultHTTPMethods {
+		for _, declared := range s.HTTPMethods {
+			declared = strings.ToUpper(declared)
+			if declared == method || (method == "HEAD" && declared == "GET") || method == "OPTIONS" {
+				allow = append(allow, method)
+				break
+			}
+		}
+	}
+
+	return allow
+}
+
+// Allows reports whether the object accepts the HTTP method
+func (s *Service) Allows(httpMethod string) bool {
+	for _, method := range s.Allow() {
+		if method == httpMethod {
+			return true
+		}
+	}
+	return false
+}
+
+// Streams reports whether the method replies with a stream of chunks
+func (s *Service) Streams(method string) bool {
+	for _, streamed := range s.Streaming {
+		if streamed == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) expired(now time.Time) bool {
+	return s.Expires != nil && now.After(*s.Expires)
+}
+
+// ValidObject checks the object name is a single lowercase token. ex: person, user_account
+func ValidObject(object string) error {
+
+	if object == "" {
+		return errors.New("registry: object name is empty")
+	}
+	if len(object) > 64 {
+		return errors.New("registry: object name is too long: " + object)
+	}
+
+	for _, c := range object {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' && c != '-' {
+			return errors.New("registry: invalid object name: " + object)
+		}
+	}
+
+	return nil
+}
+
+// ValidPayload checks the message payload encoding is v1 or v2. Empty means v1
+func ValidPayload(payload string) error {
+	switch payload {
+	case "", "v1", "v2":
+		return nil
+	}
+	return errors.New("registry: unknown payload encoding: " + payload)
+}
+
+// ValidEncoding checks the wire encoding is json, msgpack or protobuf. Empty means json
+func ValidEncoding(encoding string) error {
+	switch encoding {
+	case "", "json", "msgpack", "protobuf":
+		return nil
+	}
+	return errors.New("registry: unknown encoding: " + encoding)
+}
+
+/*
+	ValidSubject checks the subject is a plain NATS subject a service can listen on.
+
+	Wildcards (* and >), empty tokens, whitespace and the reserved _INBOX and $ (ex: $SYS) prefixes are rejected.
+ */
+func ValidSubject(subject string) error {
+
+	if subject == "" {
+		return errors.New("registry: subject is empty")
+	}
+	if len(subject) > 255 {
+		return errors.New("registry: subject is too long: " + subject)
+	}
+	if strings.HasPrefix(subject, "$") || subject == "_INBOX" || strings.HasPrefix(subject, "_INBOX.") {
+		return errors.New("registry: reserved subject: " + subject)
+	}
+
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" {
+			return errors.New("registry: empty token in subject: " + subject)
+		}
+		for _, c := range token {
+			valid := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+			if !valid {
+				return errors.New("registry: invalid character in subject: " + subject)
+			}
+		}
+	}
+
+	return nil
+}
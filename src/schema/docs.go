@@ -0,0 +1,89 @@
+package schema
+
+import (
+	"strings"
+	"fmt"
+)
+
+/*
+	Markdown generates the reference documentation of the object.
+
+	Nested fields are listed with their full path. ex: address.zip
+ */
+func (o *Object) Markdown() string {
+
+	var b strings.Builder
+
+	title := o.Name
+	if o.Version != "" {
+		title += " (" + o.Version + ")"
+	}
+	fmt.Fprintf(&b, "## %s\n\n", title)
+	if o.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", o.Description)
+	}
+
+	b.WriteString("| Field | Type | Required | Read only | Description |\n")
+	b.WriteString("|---|---|---|---|---|\n")
+	writeFields(&b, "", o.Fields)
+
+	return b.String()
+}
+
+// Markdown generates the reference documentation of every object
+func Markdown(objects []*Object) string {
+
+	parts := make([]string, 0, len(objects)+1)
+	parts = append(parts, "# Objects\n")
+	for _, o := range objects {
+		parts = append(parts, o.Markdown())
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+func writeFields(b *strings.Builder, parent string, fields []Field) {
+
+	for _, f := range fields {
+		name := f.Name
+		if parent != "" {
+			name = parent + "." + f.Name
+		}
+
+		kind := f.Type
+		if f.Items != nil && f.Items.Type != "" {
+			kind += " of " + f.Items.Type
+		}
+		if f.Format != "" {
+			kind += " (" + f.Format + ")"
+		}
+		if f.Ref != "" {
+			kind += ", ref " + f.Ref
+		}
+
+		description := f.Description
+		if len(f.Enum) > 0 {
+			options := make([]string, len(f.Enum))
+			for i, option := range f.Enum {
+				options[i] = fmt.Sprint(option)
+			}
+			if description != "" {
+				description += ". "
+			}
+			description += "One of: " + strings.Join(options, ", ")
+		}
+
+		fmt.Fprintf(b, "| %s | %s | %s | %s | %s |\n", name, kind, yes(f.Required), yes(f.ReadOnly), description)
+
+		if len(f.Fields) > 0 {
+			writeFields(b, name, f.Fields)
+		}
+	}
+}
+
+func yes(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,99 @@
+package schema
+
+import (
+	"encoding/json"
+)
+
+/*
+	Object is the typed definition of a database object (the object behind a micro service).
+
+	A definition drives both payload validation and documentation generation.
+	Create requests must send every required field, update requests can send any subset.
+	Fields the body may send are fixed; unknown and read only fields are rejected.
+ */
+type Object struct {
+	Name 		string 	`json:"name"`				// object name. ex: person
+	Version 	string 	`json:"version,omitempty"`		// version of the definition. empty = every version
+	Description 	string 	`json:"description,omitempty"`
+	Fields 		[]Field `json:"fields"`
+}
+
+// Field is a single field of an object
+type Field struct {
+	Name 		string 		`json:"name"`
+	Type 		string 		`json:"type"`				// string, integer, number, boolean, object, array
+	Format 		string 		`json:"format,omitempty"`		// email, uuid, date, date-time, uri
+	Required 	bool 		`json:"required,omitempty"`		// must be sent on create
+	ReadOnly 	bool 		`json:"read_only,omitempty"`		// set by the service, never accepted in a body
+	Description 	string 		`json:"description,omitempty"`
+	Enum 		[]interface{} 	`json:"enum,omitempty"`
+	MinLength 	*int 		`json:"min_length,omitempty"`
+	MaxLength 	*int 		`json:"max_length,omitempty"`
+	Items 		*Field 		`json:"items,omitempty"`		// element definition of an array
+	Fields 		[]Field 	`json:"fields,omitempty"`		// fields of a nested object
+	Ref 		string 		`json:"ref,omitempty"`			// object the uuid (or list of uuids) of the field points to
+}
+
+// ParseObject decodes a JSON object definition
+func ParseObject(data []byte) (*Object, error) {
+	var o Object
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+/*
+	Schema converts the definition into the JSON Schema request bodies are validated with.
+
+	partial drops the required fields, used for updates.
+ */
+func (o *Object) Schema(partial bool) *Schema {
+	return objectSchema(o.Fields, partial)
+}
+
+func objectSchema(fields []Field, partial bool) *Schema {
+
+	closed := false
+	s := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{},
+		AdditionalProperties: &closed,
+	}
+
+	for _, field := range fields {
+		if field.ReadOnly {
+			continue
+		}
+		s.Properties[field.Name] = field.schema(partial)
+		if field.Required && !partial {
+			s.Required = append(s.Required, field.Name)
+		}
+	}
+
+	return s
+}
+
+func (f Field) schema(partial bool) *Schema {
+
+	if f.Type == "object" && len(f.Fields) > 0 {
+		s := objectSchema(f.Fields, partial)
+		s.Description = f.Description
+		return s
+	}
+
+	s := &Schema{
+		Type: f.Type,
+		Format: f.Format,
+		Description: f.Description,
+		Enum: f.Enum,
+		MinLength: f.MinLength,
+		MaxLength: f.MaxLength,
+	}
+	if f.Items != nil {
+		// array elements are always complete values
+		s.Items = f.Items.schema(false)
+	}
+
+	return s
+}
@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"strconv"
+	"strings"
+)
+
+/*
+	ValidatePatch checks a decoded JSON Patch (RFC 6902) document is well formed.
+
+	The document must be a list of operations. Every operation needs an op (add, remove, replace, move, copy, test)
+	and a JSON Pointer path; add, replace and test need a value, move and copy need a from pointer.
+ */
+func ValidatePatch(doc interface{}) []FieldError {
+
+	ops, ok := doc.([]interface{})
+	if !ok {
+		return []FieldError{{Field: "body", Message: "must be a list of patch operations"}}
+	}
+
+	var errs []FieldError
+
+	for i, item := range ops {
+		field := "[" + strconv.Itoa(i) + "]"
+
+		op, ok := item.(map[string]interface{})
+		if !ok {
+			errs = append(errs, FieldError{Field: field, Message: "must be a patch operation object"})
+			continue
+		}
+
+		name, _ := op["op"].(string)
+		switch name {
+		case "add", "replace", "test":
+			if _, ok := op["value"]; !ok {
+				errs = append(errs, FieldError{Field: field + ".value", Message: "is required"})
+			}
+		case "move", "copy":
+			if !pointer(op["from"]) {
+				errs = append(errs, FieldError{Field: field + ".from", Message: "must be a JSON Pointer"})
+			}
+		case "remove":
+		default:
+			errs = append(errs, FieldError{Field: field + ".op", Message: "must be one of add, remove, replace, move, copy, test"})
+		}
+
+		if !pointer(op["path"]) {
+			errs = append(errs, FieldError{Field: field + ".path", Message: "must be a JSON Pointer"})
+		}
+	}
+
+	return errs
+}
+
+// pointer checks the value is a JSON Pointer (RFC 6901). ex: /address/zip
+func pointer(value interface{}) bool {
+
+	p, ok := value.(string)
+	if !ok {
+		return false
+	}
+	if p == "" {
+		return true
+	}
+	if !strings.HasPrefix(p, "/") {
+		return false
+	}
+
+	// ~ must be escaped as ~0 or ~1
+	for i := 0; i < len(p); i++ {
+		if p[i] == '~' && (i+1 >= len(p) || (p[i+1] != '0' && p[i+1] != '1')) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+/*
+	Schema is the subset of JSON Schema the gateway validates request bodies with.
+
+	Supported keywords: type, properties, required, additionalProperties, items, enum, format,
+	minLength, maxLength, pattern, minimum, maximum, minItems, maxItems.
+	Supported formats: email, uuid, date, date-time, uri.
+ */
+type Schema struct {
+	Type 			string 			`json:"type,omitempty"`		// object, array, string, number, integer, boolean, null
+	Description 		string 			`json:"description,omitempty"`
+	Properties 		map[string]*Schema 	`json:"properties,omitempty"`
+	Required 		[]string 		`json:"required,omitempty"`
+	AdditionalProperties 	*bool 			`json:"additionalProperties,omitempty"`
+	Items 			*Schema 		`json:"items,omitempty"`
+	Enum 			[]interface{} 		`json:"enum,omitempty"`
+	Format 			string 			`json:"format,omitempty"`
+	MinLength 		*int 			`json:"minLength,omitempty"`
+	MaxLength 		*int 			`json:"maxLength,omitempty"`
+	Pattern 		string 			`json:"pattern,omitempty"`
+	Minimum 		*float64 		`json:"minimum,omitempty"`
+	Maximum 		*float64 		`json:"maximum,omitempty"`
+	MinItems 		*int 			`json:"minItems,omitempty"`
+	MaxItems 		*int 			`json:"maxItems,omitempty"`
+
+	pattern 		*regexp.Regexp 		// Pattern, compiled once when the schema is parsed or registered
+}
+
+// FieldError is a validation error for a single field of the request body
+type FieldError struct {
+	Field 	string 	`json:"field"`		// path of the field. ex: address.zip, tags[0]
+	Message string 	`json:"message"`
+}
+
+// Parse decodes a JSON Schema document, an invalid pattern fails the schema
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// compile compiles the patterns of the schema and of every nested schema
+func (s *Schema) compile() error {
+
+	if s.Pattern != "" && s.pattern == nil {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+
+	for _, property := range s.Properties {
+		if err := property.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+
+	return nil
+}
@@ -0,0 +1,272 @@
+package schema
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"io/ioutil"
+	"strings"
+	"sort"
+	"sync"
+	"log"
+	"os"
+)
+
+/*
+	Store holds the request schemas services register per object, method and version.
+
+	Schemas are loaded from SCHEMA_DIR, laid out as <object>/<method>.json for every version
+	or <object>/<method>.<version>.json for a single version. ex: person/create.json, person/update.V2.json
+	Services can also send their schemas with their discovery announcement, see Announce.
+	Announced schemas win over the ones of SCHEMA_DIR, they are dropped when the service expires (Forget).
+
+	Typed object definitions (see Object) are loaded from the top level <object>.json files of SCHEMA_DIR.
+	They apply to the create and update methods of the object when those don't have their own schema.
+ */
+type Store struct {
+	mu 	sync.RWMutex
+	schemas map[string]*Schema	// key: object/method/version
+	objects map[string]*Object	// key: object/version
+	hashes 	map[string]string	// object -> schema hash of the last announcement
+	announced map[string]map[string]*Schema	// object -> schemas of the last announcement, key: object/method/version
+}
+
+// NewStore creates an empty schema store
+func NewStore() *Store {
+	return &Store{
+		schemas: map[string]*Schema{},
+		objects: map[string]*Object{},
+		hashes: map[string]string{},
+		announced: map[string]map[string]*Schema{},
+	}
+}
+
+// FromEnv creates a schema store and loads SCHEMA_DIR
+func FromEnv() *Store {
+
+	st := NewStore()
+
+	if dir := os.Getenv("SCHEMA_DIR"); dir != "" {
+		if err := st.LoadDir(dir); err != nil {
+			log.Println(">>> ERROR: SCHEMA_DIR - ", err)
+		}
+	}
+
+	return st
+}
+
+func key(object string, method string, version string) string {
+	return object + "/" + method + "/" + version
+}
+
+// Register adds the schema for object/method/version. An empty version applies to every version
+func (st *Store) Register(object string, method string, version string, s *Schema) error {
+
+	if err := s.compile(); err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	st.schemas[key(object, method, version)] = s
+	st.mu.Unlock()
+
+	return nil
+}
+
+/*
+	Lookup returns the schema for object/method/version, falling back to the schema for every version.
+	When the service announced schemas only the announced ones are used.
+ */
+func (st *Store) Lookup(object string, method string, version string) (*Schema, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	schemas := st.schemas
+	if announced, ok := st.announced[object]; ok {
+		schemas = announced
+	}
+
+	if s, ok := schemas[key(object, method, version)]; ok {
+		return s, true
+	}
+	s, ok := schemas[key(object, method, "")]
+	return s, ok
+}
+
+// RegisterObject adds a typed object definition
+func (st *Store) RegisterObject(o *Object) {
+	st.mu.Lock()
+	st.objects[o.Name + "/" + o.Version] = o
+	st.mu.Unlock()
+}
+
+// Object returns the definition of the object for version, falling back to the definition for every version
+func (st *Store) Object(name string, version string) (*Object, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	if o, ok := st.objects[name + "/" + version]; ok {
+		return o, true
+	}
+	o, ok := st.objects[name + "/"]
+	return o, ok
+}
+
+// Objects returns every object definition ordered by name and version
+func (st *Store) Objects() []*Object {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	list := make([]*Object, 0, len(st.objects))
+	for _, o := range st.objects {
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Version < list[j].Version
+	})
+
+	return list
+}
+
+/*
+	Validate checks the decoded request body against the schema registered for object/method/version.
+
+	The create and update methods fall back to the object definition when they have no schema of their own:
+	POST bodies must be complete, PUT and PATCH bodies can be partial. Other methods (ex: search) take bodies
+	that aren't objects of the definition, they are only validated with their own schema.
+	PATCH bodies are merge patches, null is accepted for every property (see Schema.ValidateMergePatch).
+ */
+func (st *Store) Validate(object string, method string, version string, httpMethod string, doc interface{}) []FieldError {
+
+	s, ok := st.Lookup(object, method, version)
+	if !ok {
+		if method != "create" && method != "update" {
+			return nil
+		}
+		o, found := st.Object(object, version)
+		if !found {
+			return nil
+		}
+		s = o.Schema(httpMethod != "POST")
+	}
+
+	if httpMethod == "PATCH" {
+		return s.ValidateMergePatch(doc)
+	}
+
+	return s.Validate(doc)
+}
+
+// LoadDir registers every schema file found in dir
+func (st *Store) LoadDir(dir string) error {
+
+	objects, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+
+		// <object>.json is a typed object definition
+		if !object.IsDir() {
+			if filepath.Ext(object.Name()) != ".json" {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(dir, object.Name()))
+			if err != nil {
+				return err
+			}
+			o, err := ParseObject(data)
+			if err != nil {
+				return err
+			}
+			st.RegisterObject(o)
+			continue
+		}
+
+		files, err := filepath.Glob(filepath.Join(dir, object.Name(), "*.json"))
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+
+			s, err := Parse(data)
+			if err != nil {
+				return err
+			}
+
+			// <method>.json or <method>.<version>.json
+			name := strings.TrimSuffix(filepath.Base(file), ".json")
+			method, version := name, ""
+			if i := strings.Index(name, "."); i >= 0 {
+				method, version = name[:i], name[i+1:]
+			}
+
+			if err := st.Register(object.Name(), method, version, s); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+	Announce replaces the schemas of the object with the ones the service sent with its discovery announcement.
+
+	Schemas are keyed by <method> or <method>@<version>, methods the announcement leaves out are no longer
+	validated with an announced schema. They are only parsed again when the schema hash of the announcement
+	changes. A schema that fails to parse (ex: invalid pattern) rejects the whole announcement.
+ */
+func (st *Store) Announce(object string, hash string, schemas map[string]json.RawMessage) error {
+
+	st.mu.RLock()
+	current, seen := st.hashes[object]
+	st.mu.RUnlock()
+
+	if seen && hash != "" && current == hash {
+		return nil
+	}
+
+	announced := map[string]*Schema{}
+	for name, raw := range schemas {
+		s, err := Parse(raw)
+		if err != nil {
+			return err
+		}
+
+		method, version := name, ""
+		if i := strings.Index(name, "@"); i >= 0 {
+			method, version = name[:i], name[i+1:]
+		}
+
+		announced[key(object, method, version)] = s
+	}
+
+	st.mu.Lock()
+	if len(announced) > 0 {
+		st.announced[object] = announced
+	} else {
+		delete(st.announced, object)
+	}
+	st.hashes[object] = hash
+	st.mu.Unlock()
+
+	return nil
+}
+
+// Forget drops the announced schemas of the object, called when its service expires
+func (st *Store) Forget(object string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	delete(st.announced, object)
+	delete(st.hashes, object)
+}
@@ -0,0 +1,193 @@
+package schema
+
+import (
+	"reflect"
+	"strconv"
+	"net/url"
+	"regexp"
+	"sort"
+	"time"
+	"math"
+	"fmt"
+)
+
+var (
+	emailFormat = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	uuidFormat = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+/*
+	Validate checks a decoded JSON document (the result of json.Decode into interface{}) against the schema.
+
+	Returns every field that failed, an empty list means the document is valid.
+ */
+func (s *Schema) Validate(doc interface{}) []FieldError {
+	var errs []FieldError
+	s.validate("", doc, false, &errs)
+	return errs
+}
+
+/*
+	ValidateMergePatch checks a JSON Merge Patch (RFC 7396) document against the schema.
+
+	A merge patch is partial and null deletes a field, so required is skipped and every property accepts null.
+	Nested objects are merge patches too; arrays replace the whole value and are validated like any document.
+ */
+func (s *Schema) ValidateMergePatch(doc interface{}) []FieldError {
+	var errs []FieldError
+	s.validate("", doc, true, &errs)
+	return errs
+}
+
+func (s *Schema) validate(field string, value interface{}, merge bool, errs *[]FieldError) {
+
+	fail := func(format string, args ...interface{}) {
+		name := field
+		if name == "" {
+			name = "body"
+		}
+		*errs = append(*errs, FieldError{Field: name, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// null deletes the field of a merge patch
+	if merge && field != "" && value == nil {
+		return
+	}
+
+	if s.Type != "" && !matchesType(s.Type, value) {
+		fail("must be of type %s", s.Type)
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, option := range s.Enum {
+			if reflect.DeepEqual(option, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", s.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok && !merge {
+				*errs = append(*errs, FieldError{Field: join(field, name), Message: "is required"})
+			}
+		}
+
+		// validate fields in order so errors are stable
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				property.validate(join(field, name), v[name], merge, errs)
+			} else if s.AdditionalProperties != nil && *s.AdditionalProperties == false {
+				*errs = append(*errs, FieldError{Field: join(field, name), Message: "is not allowed"})
+			}
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(field+"["+strconv.Itoa(i)+"]", item, false, errs)
+			}
+		}
+
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match pattern %s", s.Pattern)
+		}
+		if s.Format != "" && !matchesFormat(s.Format, v) {
+			fail("must be a valid %s", s.Format)
+		}
+
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+func matchesType(kind string, value interface{}) bool {
+
+	switch kind {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+
+	// unknown types are not enforced
+	return true
+}
+
+func matchesFormat(format string, value string) bool {
+
+	switch format {
+	case "email":
+		return emailFormat.MatchString(value)
+	case "uuid":
+		return uuidFormat.MatchString(value)
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	}
+
+	// unknown formats are not enforced
+	return true
+}
+
+func join(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
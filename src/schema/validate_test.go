@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const personDefinition = `{
+	"name": "person",
+	"fields": [
+		{"name": "uuid", "type": "string", "format": "uuid", "read_only": true},
+		{"name": "name", "type": "string", "required": true, "min_length": 1},
+		{"name": "email", "type": "string", "format": "email", "required": true},
+		{"name": "status", "type": "string", "enum": ["active", "closed"]},
+		{"name": "address", "type": "object", "fields": [
+			{"name": "city", "type": "string", "required": true},
+			{"name": "zip", "type": "string"}
+		]}
+	]
+}`
+
+func personStore(t *testing.T) *Store {
+	o, err := ParseObject([]byte(personDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewStore()
+	st.RegisterObject(o)
+	return st
+}
+
+func decode(t *testing.T, body string) interface{} {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestMergePatchAcceptsNull(t *testing.T) {
+
+	st := personStore(t)
+	doc := decode(t, `{"status": null, "address": {"zip": null}, "name": "Ann"}`)
+
+	if errs := st.Validate("person", "update", "", "PATCH", doc); len(errs) > 0 {
+		t.Fatalf("merge patch errors = %v", errs)
+	}
+
+	// a PUT is not a merge patch, null is a value of the wrong type
+	if errs := st.Validate("person", "update", "", "PUT", doc); len(errs) == 0 {
+		t.Fatal("PUT with null fields was accepted")
+	}
+}
+
+func TestMergePatchSkipsRequired(t *testing.T) {
+
+	st := personStore(t)
+
+	if errs := st.Validate("person", "update", "", "PATCH", decode(t, `{"address": {"zip": "10001"}}`)); len(errs) > 0 {
+		t.Fatalf("merge patch errors = %v", errs)
+	}
+}
+
+func TestMergePatchStillChecksValues(t *testing.T) {
+
+	st := personStore(t)
+	errs := st.Validate("person", "update", "", "PATCH", decode(t, `{"email": "nope", "status": "gone", "uuid": null, "extra": 1}`))
+
+	fields := map[string]bool{}
+	for _, e := range errs {
+		fields[e.Field] = true
+	}
+	for _, field := range []string{"email", "status", "uuid", "extra"} {
+		if !fields[field] {
+			t.Errorf("no error for %s, errors = %v", field, errs)
+		}
+	}
+}
+
+func TestMergePatchBodyMustBeObject(t *testing.T) {
+
+	st := personStore(t)
+
+	if errs := st.Validate("person", "update", "", "PATCH", nil); len(errs) == 0 {
+		t.Fatal("null merge patch body was accepted")
+	}
+}
+
+func TestCreateRequiresFields(t *testing.T) {
+
+	st := personStore(t)
+	errs := st.Validate("person", "create", "", "POST", decode(t, `{"name": "Ann"}`))
+
+	if len(errs) != 1 || errs[0].Field != "email" || errs[0].Message != "is required" {
+		t.Fatalf("create errors = %v", errs)
+	}
+}
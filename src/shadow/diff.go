@@ -0,0 +1,170 @@
+package shadow
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"encoding/json"
+	"unicode/utf8"
+	"reflect"
+	"strconv"
+	"bytes"
+	"sort"
+)
+
+// MaxDifferences is the maximum number of differences kept in a report
+const MaxDifferences = 50
+
+// MaxValue is the longest string kept in a difference, longer ones (ex: whole non-JSON bodies) are cut
+const MaxValue = 1024
+
+// Difference is a single difference between the primary and the shadow reply
+type Difference struct {
+	Path 	string 		`json:"path"`			// JSON path of the value. ex: $.data[0].name
+	Kind 	string 		`json:"kind"`			// added, removed or changed
+	Primary interface{} 	`json:"primary,omitempty"`	// value in the primary reply
+	Shadow 	interface{} 	`json:"shadow,omitempty"`	// value in the shadow reply
+}
+
+/*
+	Compare compares the primary and the shadow reply: their status (0 is 200) and their bodies, see Diff.
+	A status difference is reported at the path "status".
+ */
+func Compare(primary models.Reply, shadow models.Reply) ([]Difference, bool) {
+
+	d := &differ{}
+	if status(primary.Status) != status(shadow.Status) {
+		d.add(Difference{Path: "status", Kind: "changed", Primary: status(primary.Status), Shadow: status(shadow.Status)})
+	}
+
+	d.bodies(primary.Body, shadow.Body)
+
+	return d.list, d.truncated
+}
+
+func status(code int) int {
+	if code == 0 {
+		return 200
+	}
+	return code
+}
+
+/*
+	Diff compares two JSON documents and returns a summary of their differences.
+
+	"added" values exist only in the shadow reply, "removed" values only in the primary reply.
+	Replies that are not valid JSON are compared byte for byte. Strings longer than MaxValue are cut in the report.
+	The second return value is true when the list was cut at MaxDifferences.
+ */
+func Diff(primary []byte, shadow []byte) ([]Difference, bool) {
+
+	d := &differ{}
+	d.bodies(primary, shadow)
+
+	return d.list, d.truncated
+}
+
+type differ struct {
+	list []Difference
+	truncated bool
+}
+
+func (d *differ) bodies(primary []byte, shadow []byte) {
+
+	var p, s interface{}
+	perr := json.Unmarshal(primary, &p)
+	serr := json.Unmarshal(shadow, &s)
+
+	if perr != nil || serr != nil {
+		if !bytes.Equal(bytes.TrimSpace(primary), bytes.TrimSpace(shadow)) {
+			d.add(Difference{Path: "$", Kind: "changed", Primary: string(primary), Shadow: string(shadow)})
+		}
+		return
+	}
+
+	d.compare("$", p, s)
+}
+
+func (d *differ) add(diff Difference) {
+	if len(d.list) >= MaxDifferences {
+		d.truncated = true
+		return
+	}
+	diff.Primary, diff.Shadow = clip(diff.Primary), clip(diff.Shadow)
+	d.list = append(d.list, diff)
+}
+
+// clip cuts strings longer than MaxValue at a rune boundary and notes their length
+func clip(value interface{}) interface{} {
+
+	s, ok := value.(string)
+	if !ok || len(s) <= MaxValue {
+		return value
+	}
+
+	cut := MaxValue
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "... (" + strconv.Itoa(len(s)) + " bytes)"
+}
+
+func (d *differ) compare(path string, p interface{}, s interface{}) {
+
+	switch pv := p.(type) {
+
+	case map[string]interface{}:
+		sv, ok := s.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		// walk keys in order so reports are stable
+		keys := make([]string, 0, len(pv)+len(sv))
+		for k := range pv {
+			keys = append(keys, k)
+		}
+		for k := range sv {
+			if _, ok := pv[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			pk, pok := pv[k]
+			sk, sok := sv[k]
+			child := path + "." + k
+			switch {
+			case !sok:
+				d.add(Difference{Path: child, Kind: "removed", Primary: pk})
+			case !pok:
+				d.add(Difference{Path: child, Kind: "added", Shadow: sk})
+			default:
+				d.compare(child, pk, sk)
+			}
+		}
+		return
+
+	case []interface{}:
+		sv, ok := s.([]interface{})
+		if !ok {
+			break
+		}
+
+		for i := 0; i < len(pv) || i < len(sv); i++ {
+			child := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(sv):
+				d.add(Difference{Path: child, Kind: "removed", Primary: pv[i]})
+			case i >= len(pv):
+				d.add(Difference{Path: child, Kind: "added", Shadow: sv[i]})
+			default:
+				d.compare(child, pv[i], sv[i])
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(p, s) {
+		d.add(Difference{Path: path, Kind: "changed", Primary: p, Shadow: s})
+	}
+}
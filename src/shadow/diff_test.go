@@ -0,0 +1,94 @@
+package shadow
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+
+	large := strings.Repeat("x", 3*MaxValue)
+
+	for _, test := range []struct {
+		name 		string
+		primary 	models.Reply
+		shadow 		models.Reply
+		want 		[]Difference
+	}{
+		{
+			name: "equal bodies",
+			primary: models.Reply{Body: []byte(`{"a": 1, "b": [1, 2]}`)},
+			shadow: models.Reply{Status: 200, Body: []byte(`{"b":[1,2],"a":1}`)},
+		},
+		{
+			name: "equal non-JSON bodies",
+			primary: models.Reply{Body: []byte("ok\n")},
+			shadow: models.Reply{Body: []byte("ok")},
+		},
+		{
+			name: "status only",
+			primary: models.Reply{Status: 200, Body: []byte(`{"a": 1}`)},
+			shadow: models.Reply{Status: 404, Body: []byte(`{"a": 1}`)},
+			want: []Difference{{Path: "status", Kind: "changed", Primary: 200, Shadow: 404}},
+		},
+		{
+			name: "fields",
+			primary: models.Reply{Body: []byte(`{"name": "Ann", "old": true, "list": [1, 2]}`)},
+			shadow: models.Reply{Body: []byte(`{"name": "Bob", "new": 1, "list": [1]}`)},
+			want: []Difference{
+				{Path: "$.list[1]", Kind: "removed", Primary: float64(2)},
+				{Path: "$.name", Kind: "changed", Primary: "Ann", Shadow: "Bob"},
+				{Path: "$.new", Kind: "added", Shadow: float64(1)},
+				{Path: "$.old", Kind: "removed", Primary: true},
+			},
+		},
+		{
+			name: "oversized non-JSON bodies",
+			primary: models.Reply{Body: []byte(large)},
+			shadow: models.Reply{Body: []byte("short")},
+			want: []Difference{{Path: "$", Kind: "changed", Primary: large[:MaxValue] + "... (" + strconv.Itoa(len(large)) + " bytes)", Shadow: "short"}},
+		},
+		{
+			name: "oversized values",
+			primary: models.Reply{Body: []byte(`{"text": "` + large + `"}`)},
+			shadow: models.Reply{Body: []byte(`{"text": ""}`)},
+			want: []Difference{{Path: "$.text", Kind: "changed", Primary: large[:MaxValue] + "... (" + strconv.Itoa(len(large)) + " bytes)", Shadow: ""}},
+		},
+	} {
+		got, truncated := Compare(test.primary, test.shadow)
+		if truncated {
+			t.Errorf("%s: truncated", test.name)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: difference %d = %+v, want %+v", test.name, i, got[i], test.want[i])
+			}
+		}
+	}
+}
+
+func TestDiffTruncated(t *testing.T) {
+
+	var primary, shadow []string
+	for i := 0; i < MaxDifferences + 10; i++ {
+		primary = append(primary, strconv.Itoa(i))
+		shadow = append(shadow, strconv.Itoa(-i - 1))
+	}
+
+	got, truncated := Diff([]byte("[" + strings.Join(primary, ",") + "]"), []byte("[" + strings.Join(shadow, ",") + "]"))
+	if !truncated || len(got) != MaxDifferences {
+		t.Fatalf("got %d differences (truncated %v), want %d and truncated", len(got), truncated, MaxDifferences)
+	}
+
+	// the status counts towards the limit too
+	got, truncated = Compare(models.Reply{Status: 500, Body: []byte("[" + strings.Join(primary, ",") + "]")}, models.Reply{Body: []byte("[" + strings.Join(shadow, ",") + "]")})
+	if !truncated || len(got) != MaxDifferences || got[0].Path != "status" {
+		t.Fatalf("Compare: %d differences, first %+v", len(got), got[0])
+	}
+}
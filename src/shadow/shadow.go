@@ -0,0 +1,206 @@
+package shadow
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/models"
+	"github.com/stevenmahana/ApiMainTemplate/src/codec"
+	"github.com/nats-io/nats.go"
+	"encoding/json"
+	"strings"
+	"time"
+	"log"
+	"os"
+)
+
+/*
+	Shadow copies live requests to a secondary (shadow) NATS subject.
+
+	Used before cutting over a rewritten service. The shadow reply is never returned to the client,
+	it is compared with the primary reply and the differences are recorded for review.
+
+	Only reads (GET and HEAD) are mirrored, a shadow target sees writes only when it opts in with :writes,
+	otherwise every write would be executed twice.
+
+	SHADOW_SUBJECTS: comma separated list of <subject>:<shadow subject>[:writes]. ex: person:person_v2,account:account_next:writes
+	SHADOW_DIFF_SUBJECT: NATS subject the comparison reports are published on. Reports are logged when empty
+	SHADOW_TIMEOUT: how long to wait for the shadow reply. Default = 3s
+ */
+type Shadow struct {
+	Subjects 	map[string]Target	// primary subject -> shadow target
+	DiffSubject 	string			// subject reports are published on
+	Timeout 	time.Duration		// shadow reply timeout
+}
+
+// Target is the shadow subject of a primary subject
+type Target struct {
+	Subject 	string 		// shadow subject
+	Writes 		bool 		// mirror POST, PUT, PATCH and DELETE too
+}
+
+// Report is the comparison of the primary and the shadow reply for one request
+type Report struct {
+	Subject 	string 		`json:"subject"`		// primary subject
+	ShadowSubject 	string 		`json:"shadow_subject"`	// shadow subject
+	Method 		string 		`json:"method"`			// method that was requested
+	Match 		bool 		`json:"match"`			// true when both replies are equal
+	PrimaryError 	string 		`json:"primary_error,omitempty"`
+	ShadowError 	string 		`json:"shadow_error,omitempty"`
+	PrimaryTime 	int64 		`json:"primary_ms"`		// primary round trip in milliseconds
+	ShadowTime 	int64 		`json:"shadow_ms"`		// shadow round trip in milliseconds
+	Differences 	[]Difference 	`json:"differences,omitempty"`
+	Truncated 	bool 		`json:"truncated,omitempty"`	// more than MaxDifferences were found
+	Time 		time.Time 	`json:"time"`
+}
+
+// Comparison waits for the primary reply of a mirrored request
+type Comparison struct {
+	started time.Time
+	primary chan reply
+}
+
+type reply struct {
+	reply models.Reply
+	err error
+	elapsed time.Duration
+}
+
+// FromEnv builds the shadow configuration from the environment
+func FromEnv() *Shadow {
+
+	s := &Shadow{
+		Subjects: map[string]Target{},
+		DiffSubject: os.Getenv("SHADOW_DIFF_SUBJECT"),
+		Timeout: 3000*time.Millisecond,
+	}
+
+	for _, pair := range strings.Split(os.Getenv("SHADOW_SUBJECTS"), ",") {
+		parts := strings.Split(strings.TrimSpace(pair), ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		if len(parts) == 3 && parts[2] != "writes" {
+			log.Println(">>> ERROR: SHADOW_SUBJECTS unknown option " + parts[2])
+			continue
+		}
+		s.Subjects[parts[0]] = Target{Subject: parts[1], Writes: len(parts) == 3}
+	}
+
+	if val := os.Getenv("SHADOW_TIMEOUT"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			s.Timeout = d
+		} else {
+			log.Println(">>> ERROR: SHADOW_TIMEOUT - ", err)
+		}
+	}
+
+	return s
+}
+
+/*
+	Start mirrors the message to the shadow subject of subject, if there is one and it takes the HTTP method.
+
+	The shadow request runs in the background on its own connection so it never delays the client.
+	Returns nil when the request is not mirrored; a nil Comparison is safe to use.
+ */
+func (s *Shadow) Start(subject string, httpMethod string, method string, contentType string, message []byte) *Comparison {
+
+	if s == nil {
+		return nil
+	}
+
+	target, ok := s.Subjects[subject]
+	if !ok {
+		return nil
+	}
+	if httpMethod != "GET" && httpMethod != "HEAD" && !target.Writes {
+		return nil
+	}
+
+	c := &Comparison{
+		started: time.Now(),
+		primary: make(chan reply, 1),
+	}
+
+	go s.run(c, subject, target.Subject, method, contentType, message)
+
+	return c
+}
+
+// Primary hands the primary reply (JSON body) to the comparison
+func (c *Comparison) Primary(primary models.Reply, err error) {
+	if c == nil {
+		return
+	}
+	c.primary <- reply{reply: primary, err: err, elapsed: time.Since(c.started)}
+}
+
+// run sends the shadow request, waits for the primary reply and records the report
+func (s *Shadow) run(c *Comparison, subject string, target string, method string, contentType string, message []byte) {
+
+	report := Report{
+		Subject: subject,
+		ShadowSubject: target,
+		Method: method,
+		Time: c.started,
+	}
+
+	uri := os.Getenv("NATS_URI")
+
+	// Connect to NATS server; defer close
+	natsConnection, err := nats.Connect(uri)
+	if err != nil {
+		log.Println(">>> ERROR: Shadow Connect Error - ", err)
+		return
+	}
+	defer natsConnection.Close()
+
+	// Send Message to shadow subject, in the same encoding as the primary request
+	request := nats.NewMsg(target)
+	request.Header.Set(codec.ContentTypeHeader, contentType)
+	request.Data = message
+
+	var shadowReply models.Reply
+	msg, err := natsConnection.RequestMsg(request, s.Timeout)
+	report.ShadowTime = int64(time.Since(c.started) / time.Millisecond)
+	if err == nil {
+		shadowReply, err = codec.ReadReply(msg)
+	}
+	if err != nil {
+		report.ShadowError = err.Error()
+	}
+
+	// Wait for the primary reply; the primary request always finishes within its own timeout
+	primary := <-c.primary
+	report.PrimaryTime = int64(primary.elapsed / time.Millisecond)
+	if primary.err != nil {
+		report.PrimaryError = primary.err.Error()
+	}
+
+	// compare replies only when both services answered
+	if primary.err == nil && err == nil {
+		report.Differences, report.Truncated = Compare(primary.reply, shadowReply)
+	}
+	report.Match = report.PrimaryError == "" && report.ShadowError == "" && len(report.Differences) == 0
+
+	s.record(natsConnection, report)
+}
+
+// record publishes the report on the diff subject, or logs it when no subject is configured
+func (s *Shadow) record(natsConnection *nats.Conn, report Report) {
+
+	out, err := json.Marshal(report)
+	if err != nil {
+		log.Println(">>> ERROR: Shadow Report Marshal error - ", err)
+		return
+	}
+
+	if s.DiffSubject == "" {
+		log.Println("Shadow report: " + string(out))
+		return
+	}
+
+	if err := natsConnection.Publish(s.DiffSubject, out); err != nil {
+		log.Println(">>> ERROR: Shadow Report Publish error - ", err)
+		return
+	}
+	natsConnection.Flush()
+}
@@ -1,11 +1,12 @@
 package src
 
 import (
-	"./schema"
+	"github.com/stevenmahana/ApiMainTemplate/src/schema"
 	"fmt"
 )
 
+// main prints the documentation of the object definitions in SCHEMA_DIR
 func main()  {
 
-	fmt.Println(schema.PersonSchema("sdfsdfsdf"))
+	fmt.Println(schema.Markdown(schema.FromEnv().Objects()))
 }
@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// DeadLetter is a delivery that failed every attempt, with the event it carried
+type DeadLetter struct {
+	Delivery 	Delivery 	`json:"delivery"`
+	Payload 	json.RawMessage `json:"payload"`
+}
+
+/*
+	DeadLetters stores the deliveries that failed every attempt, for review and replay.
+
+	The default store keeps them in memory, replace Manager.DeadLetters to keep them elsewhere.
+ */
+type DeadLetters interface {
+	Add(letter DeadLetter)
+	List(subscription string) []DeadLetter
+}
+
+// MemoryDeadLetters keeps the last Size dead letters in the gateway process
+type MemoryDeadLetters struct {
+	Size 	int
+
+	mu 	sync.Mutex
+	letters []DeadLetter
+}
+
+// NewMemoryDeadLetters creates an empty store of size letters
+func NewMemoryDeadLetters(size int) *MemoryDeadLetters {
+	return &MemoryDeadLetters{Size: size}
+}
+
+func (s *MemoryDeadLetters) Add(letter DeadLetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.letters = append(s.letters, letter)
+	if len(s.letters) > s.Size {
+		s.letters = append([]DeadLetter{}, s.letters[len(s.letters)-s.Size:]...)
+	}
+}
+
+// List returns the dead letters of the subscription, newest first
+func (s *MemoryDeadLetters) List(subscription string) []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []DeadLetter{}
+	for i := len(s.letters) - 1; i >= 0; i-- {
+		if s.letters[i].Delivery.Subscription == subscription {
+			list = append(list, s.letters[i])
+		}
+	}
+	return list
+}
@@ -0,0 +1,208 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"bytes"
+	"sync"
+	"time"
+	"io"
+)
+
+// Delivery states
+const (
+	Pending = "pending"		// queued or waiting for a retry
+	Delivered = "delivered"		// the target answered 2xx
+	Retrying = "retrying"		// the attempt failed, another one is scheduled
+	Dead = "dead"			// every attempt failed, the delivery is in the dead letter store
+)
+
+// Delivery is one attempt to deliver an event to a subscription
+type Delivery struct {
+	ID 		string 		`json:"id"`			// same for every attempt of an event
+	Subscription 	string 		`json:"subscription"`
+	Event 		string 		`json:"event"`			// event id
+	Type 		string 		`json:"type"`			// event type
+	Attempt 	int 		`json:"attempt"`
+	Status 		string 		`json:"status"`
+	ResponseStatus 	int 		`json:"response_status,omitempty"`
+	Error 		string 		`json:"error,omitempty"`
+	Duration 	int64 		`json:"duration_ms"`
+	Time 		time.Time 	`json:"time"`
+	NextAttempt 	*time.Time 	`json:"next_attempt,omitempty"`
+}
+
+// attempt is a queued delivery with its payload
+type attempt struct {
+	subscription 	string
+	delivery 	Delivery
+	payload 	[]byte
+}
+
+/*
+	Sign returns the signature of a delivery: hex HMAC-SHA256 of "<timestamp>.<body>" with the subscription secret.
+
+	Receivers recompute it from the X-Webhook-Timestamp header and the raw body, compare it with
+	X-Webhook-Signature (sha256=<signature>) in constant time and reject old timestamps to stop replays.
+ */
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueue hands the attempt to the workers, a full queue dead letters it
+func (m *Manager) enqueue(a *attempt) {
+	select {
+	case m.queue <- a:
+	default:
+		a.delivery.Error = "delivery queue is full"
+		m.dead(a)
+	}
+}
+
+func (m *Manager) worker() {
+	for a := range m.queue {
+		m.deliver(a)
+	}
+}
+
+/*
+	deliver POSTs the event to the target of the subscription.
+
+	Any answer other than 2xx is a failure. Failed attempts are retried after Backoff, doubled on every
+	attempt (max 1h, with jitter), until MaxAttempts; then the delivery goes to the dead letter store.
+	Deliveries of removed subscriptions are dropped.
+ */
+func (m *Manager) deliver(a *attempt) {
+
+	m.mu.RLock()
+	s, ok := m.subscriptions[a.subscription]
+	var target Subscription
+	if ok {
+		target = *s
+	}
+	m.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	d := &a.delivery
+	d.Attempt++
+	d.Time = time.Now().UTC()
+	d.NextAttempt = nil
+	d.ResponseStatus = 0
+	d.Error = ""
+
+	timestamp := d.Time.Unix()
+	request, err := http.NewRequest("POST", target.URL, bytes.NewReader(a.payload))
+	if err == nil {
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("User-Agent", "ApiMainTemplate-Webhooks")
+		request.Header.Set("X-Webhook-Id", target.ID)
+		request.Header.Set("X-Webhook-Delivery", d.ID)
+		request.Header.Set("X-Webhook-Event", d.Type)
+		request.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+		request.Header.Set("X-Webhook-Signature", "sha256=" + Sign(target.Secret, timestamp, a.payload))
+
+		var response *http.Response
+		response, err = m.Client.Do(request)
+		if err == nil {
+			// drain a little of the body so the connection can be reused
+			io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+			response.Body.Close()
+			d.ResponseStatus = response.StatusCode
+		}
+	}
+	d.Duration = time.Since(d.Time).Nanoseconds() / int64(time.Millisecond)
+
+	switch {
+	case err != nil:
+		d.Error = err.Error()
+	case d.ResponseStatus < 200 || d.ResponseStatus > 299:
+		d.Error = "target answered " + strconv.Itoa(d.ResponseStatus)
+	default:
+		d.Status = Delivered
+		m.log.add(*d)
+		return
+	}
+
+	if d.Attempt >= m.MaxAttempts {
+		m.dead(a)
+		return
+	}
+
+	wait := backoff(m.Backoff, d.Attempt)
+	next := time.Now().Add(wait).UTC()
+	d.Status = Retrying
+	d.NextAttempt = &next
+	m.log.add(*d)
+
+	time.AfterFunc(wait, func() { m.enqueue(a) })
+}
+
+// dead moves the delivery to the dead letter store
+func (m *Manager) dead(a *attempt) {
+
+	a.delivery.Status = Dead
+	a.delivery.NextAttempt = nil
+	m.log.add(a.delivery)
+
+	m.DeadLetters.Add(DeadLetter{Delivery: a.delivery, Payload: a.payload})
+}
+
+// backoff is base * 2^(attempt-1), at most an hour, plus up to 10% jitter so retries don't line up
+func backoff(base time.Duration, attempt int) time.Duration {
+
+	wait := base
+	for i := 1; i < attempt && wait < time.Hour; i++ {
+		wait *= 2
+	}
+	if wait > time.Hour {
+		wait = time.Hour
+	}
+
+	return wait + time.Duration(rand.Int63n(int64(wait)/10 + 1))
+}
+
+// deliveryLog keeps the last attempts of every subscription
+type deliveryLog struct {
+	mu 	sync.Mutex
+	size 	int
+	entries map[string][]Delivery
+}
+
+func newDeliveryLog(size int) *deliveryLog {
+	return &deliveryLog{size: size, entries: map[string][]Delivery{}}
+}
+
+func (l *deliveryLog) add(d Delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := append(l.entries[d.Subscription], d)
+	if len(entries) > l.size {
+		entries = append([]Delivery{}, entries[len(entries)-l.size:]...)
+	}
+	l.entries[d.Subscription] = entries
+}
+
+// list returns the attempts of the subscription, newest first
+func (l *deliveryLog) list(subscription string) []Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := l.entries[subscription]
+	list := make([]Delivery, len(entries))
+	for i, d := range entries {
+		list[len(entries)-1-i] = d
+	}
+	return list
+}
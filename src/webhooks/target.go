@@ -0,0 +1,110 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"syscall"
+	"errors"
+	"time"
+	"net"
+)
+
+// ErrTarget is returned when the host of a webhook URL is, or resolves to, an internal address
+var ErrTarget = errors.New("webhooks: url must resolve to a public address")
+
+// blocked are the ranges public() rejects on top of the loopback, private, link-local and unspecified ones
+var blocked = cidrs("0.0.0.0/8", "100.64.0.0/10", "198.18.0.0/15")
+
+func cidrs(list ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range list {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// public reports whether ip is routable on the internet, so a delivery to it can't reach the gateway's own network
+func public(ip net.IP) bool {
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, n := range blocked {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+	checkTarget resolves the host of the URL and fails with ErrTarget when any of its addresses isn't public.
+
+	Skipped when AllowPrivate is set. The check is repeated on every delivery (see control),
+	a host that resolves to a public address now may resolve to an internal one later.
+ */
+func (m *Manager) checkTarget(u *url.URL) error {
+
+	if m.AllowPrivate {
+		return nil
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !public(ip) {
+			return ErrTarget
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return errors.New("webhooks: url host can't be resolved")
+	}
+	for _, addr := range addrs {
+		if !public(addr.IP) {
+			return ErrTarget
+		}
+	}
+
+	return nil
+}
+
+// control is the net.Dialer Control of the delivery client, it refuses connections to addresses that aren't public
+func (m *Manager) control(network string, address string, c syscall.RawConn) error {
+
+	if m.AllowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !public(ip) {
+		return ErrTarget
+	}
+
+	return nil
+}
+
+// transport dials with control and never uses a proxy, the proxy would make the connections instead of the dialer
+func (m *Manager) transport() *http.Transport {
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = (&net.Dialer{
+		Timeout: 30*time.Second,
+		KeepAlive: 30*time.Second,
+		Control: m.control,
+	}).DialContext
+
+	return t
+}
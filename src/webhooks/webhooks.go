@@ -0,0 +1,391 @@
+package webhooks
+
+import (
+	"github.com/stevenmahana/ApiMainTemplate/src/events"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"log"
+	"os"
+)
+
+/*
+	Subscription is a webhook: the events of an object POSTed to a URL of the user that registered it.
+
+	Events is the list of event types to deliver (ex: created, updated), empty for every type.
+	Only events the user may see are delivered, see events.Event.Visible. Events limited to perspectives
+	are only delivered to subscriptions of their owner or audience registered with one of them.
+	Secret signs the deliveries, it is only returned when the subscription is created.
+ */
+type Subscription struct {
+	ID 		string 		`json:"id"`
+	Auid 		string 		`json:"-"`
+	Object 		string 		`json:"object"`
+	Events 		[]string 	`json:"events,omitempty"`
+	Perspective 	string 		`json:"perspective,omitempty"`
+	URL 		string 		`json:"url"`
+	Secret 		string 		`json:"secret,omitempty"`
+	Created 	time.Time 	`json:"created"`
+}
+
+// Public is the subscription without its secret
+func (s Subscription) Public() Subscription {
+	s.Secret = ""
+	return s
+}
+
+func (s *Subscription) wants(e *events.Event) bool {
+
+	if e.Visible(s.Auid, s.Perspective) == false {
+		return false
+	}
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, t := range s.Events {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Manager keeps the webhook subscriptions and delivers the events of their objects.
+
+	Subscriptions are saved to WEBHOOKS_FILE when it is set, so they survive restarts.
+	Events come from the events hub (EVENTS_PREFIX), see Deliver for signing and retries.
+
+	WEBHOOKS_FILE: JSON file the subscriptions are kept in
+	WEBHOOK_ALLOW_HTTP: true to allow http:// targets (local receivers). Default = https only
+	WEBHOOK_ALLOW_PRIVATE: true to allow targets on loopback, private and link-local addresses (local receivers). Default = public addresses only
+	WEBHOOK_MAX_PER_USER: subscriptions per user. Default = 20
+	WEBHOOK_WORKERS: deliveries in flight. Default = 4
+	WEBHOOK_MAX_ATTEMPTS: attempts before a delivery is dead lettered. Default = 6
+	WEBHOOK_BACKOFF: delay before the first retry, doubled on every retry (max 1h). Default = 1s
+	WEBHOOK_TIMEOUT: time the target has to answer. Default = 10s
+ */
+type Manager struct {
+	File 		string
+	AllowHTTP 	bool
+	AllowPrivate 	bool
+	MaxPerUser 	int
+	MaxAttempts 	int
+	Backoff 	time.Duration
+	Client 		*http.Client
+	DeadLetters 	DeadLetters
+
+	hub 		*events.Hub
+	mu 		sync.RWMutex
+	subscriptions 	map[string]*Subscription
+	watching 	map[string]bool 	// objects with an event watcher
+	queue 		chan *attempt
+	log 		*deliveryLog
+}
+
+// ErrLimit is returned when the user has the maximum number of subscriptions
+var ErrLimit = errors.New("webhooks: subscription limit reached")
+
+// New creates a manager that reads events from hub and starts its delivery workers
+func New(hub *events.Hub, workers int) *Manager {
+
+	m := &Manager{
+		MaxPerUser: 20,
+		MaxAttempts: 6,
+		Backoff: time.Second,
+		Client: &http.Client{
+			Timeout: 10*time.Second,
+			// a redirect is not a delivery, targets must answer themselves
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		DeadLetters: NewMemoryDeadLetters(1000),
+		hub: hub,
+		subscriptions: map[string]*Subscription{},
+		watching: map[string]bool{},
+		queue: make(chan *attempt, 1000),
+		log: newDeliveryLog(100),
+	}
+
+	// the dialer re-checks the address of every delivery, see control
+	m.Client.Transport = m.transport()
+
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+
+	return m
+}
+
+// FromEnv creates the manager from the WEBHOOK* variables and loads WEBHOOKS_FILE
+func FromEnv(hub *events.Hub) *Manager {
+
+	m := New(hub, envInt("WEBHOOK_WORKERS", 4))
+	m.File = os.Getenv("WEBHOOKS_FILE")
+	m.AllowHTTP = os.Getenv("WEBHOOK_ALLOW_HTTP") == "true"
+	m.AllowPrivate = os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+	m.MaxPerUser = envInt("WEBHOOK_MAX_PER_USER", m.MaxPerUser)
+	m.MaxAttempts = envInt("WEBHOOK_MAX_ATTEMPTS", m.MaxAttempts)
+	m.Backoff = envDuration("WEBHOOK_BACKOFF", m.Backoff)
+	m.Client.Timeout = envDuration("WEBHOOK_TIMEOUT", m.Client.Timeout)
+
+	if m.File != "" {
+		if err := m.load(); err != nil && !os.IsNotExist(err) {
+			log.Println(">>> ERROR: WEBHOOKS_FILE - ", err)
+		}
+	}
+
+	return m
+}
+
+/*
+	Register validates and adds a subscription of the user. A secret is generated when none is set.
+
+	The URL host must resolve to public addresses only (see checkTarget), so a subscription can't
+	make the gateway POST to the cloud metadata endpoint or services on its own network.
+ */
+func (m *Manager) Register(s Subscription) (Subscription, error) {
+
+	u, err := url.Parse(s.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && !(m.AllowHTTP && u.Scheme == "http")) {
+		if m.AllowHTTP {
+			return Subscription{}, errors.New("webhooks: url must be an absolute http or https URL")
+		}
+		return Subscription{}, errors.New("webhooks: url must be an absolute https URL")
+	}
+	if s.Object == "" {
+		return Subscription{}, errors.New("webhooks: object is required")
+	}
+	if err := m.checkTarget(u); err != nil {
+		return Subscription{}, err
+	}
+	if s.Secret == "" {
+		s.Secret = randomHex(32)
+	}
+
+	s.ID = randomHex(16)
+	s.Created = time.Now().UTC()
+
+	m.mu.Lock()
+	count := 0
+	for _, existing := range m.subscriptions {
+		if existing.Auid == s.Auid {
+			count++
+		}
+	}
+	if count >= m.MaxPerUser {
+		m.mu.Unlock()
+		return Subscription{}, ErrLimit
+	}
+	m.subscriptions[s.ID] = &s
+	m.mu.Unlock()
+
+	m.watch(s.Object)
+	m.save()
+
+	return s, nil
+}
+
+// Get returns the subscription of the user
+func (m *Manager) Get(id string, auid string) (Subscription, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.subscriptions[id]
+	if !ok || s.Auid != auid {
+		return Subscription{}, false
+	}
+	return *s, true
+}
+
+// List returns the subscriptions of the user, oldest first
+func (m *Manager) List(auid string) []Subscription {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []Subscription{}
+	for _, s := range m.subscriptions {
+		if s.Auid == auid {
+			list = append(list, *s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+
+	return list
+}
+
+// Remove deletes the subscription of the user, pending retries are dropped
+func (m *Manager) Remove(id string, auid string) bool {
+
+	m.mu.Lock()
+	s, ok := m.subscriptions[id]
+	if ok && s.Auid == auid {
+		delete(m.subscriptions, id)
+	}
+	m.mu.Unlock()
+
+	if !ok || s.Auid != auid {
+		return false
+	}
+
+	m.save()
+	return true
+}
+
+// Deliveries returns the delivery log of a subscription, newest first
+func (m *Manager) Deliveries(id string) []Delivery {
+	return m.log.list(id)
+}
+
+/*
+	watch starts the event watcher of an object once. The watcher lives as long as the gateway,
+	events of objects without subscriptions are skipped.
+ */
+func (m *Manager) watch(object string) {
+
+	m.mu.Lock()
+	if m.watching[object] {
+		m.mu.Unlock()
+		return
+	}
+	m.watching[object] = true
+	m.mu.Unlock()
+
+	go func() {
+		lastID := ""
+		for {
+			sub, err := m.hub.Subscribe(object, lastID)
+			if err != nil {
+				log.Println(">>> ERROR: Webhook Subscribe Error - ", err)
+				time.Sleep(5*time.Second)
+				continue
+			}
+
+			for e := range sub.Events {
+				lastID = e.ID
+				m.dispatch(e)
+			}
+			// dropped as a slow consumer, resume after the last event
+		}
+	}()
+}
+
+// dispatch queues a delivery for every subscription that wants the event
+func (m *Manager) dispatch(e *events.Event) {
+
+	m.mu.RLock()
+	var targets []Subscription
+	for _, s := range m.subscriptions {
+		if s.Object == e.Object && s.wants(e) {
+			targets = append(targets, *s)
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	payload, err := e.Public()
+	if err != nil {
+		log.Println(">>> ERROR: JSON Marshal error - ", err)
+		return
+	}
+
+	for _, s := range targets {
+		a := &attempt{
+			subscription: s.ID,
+			delivery: Delivery{ID: randomHex(16), Subscription: s.ID, Event: e.ID, Type: e.Type, Status: Pending},
+			payload: payload,
+		}
+		m.enqueue(a)
+	}
+}
+
+func (m *Manager) load() error {
+
+	data, err := ioutil.ReadFile(m.File)
+	if err != nil {
+		return err
+	}
+
+	var saved []struct {
+		Subscription
+		Auid string `json:"auid"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	for _, entry := range saved {
+		s := entry.Subscription
+		s.Auid = entry.Auid
+		m.mu.Lock()
+		m.subscriptions[s.ID] = &s
+		m.mu.Unlock()
+		m.watch(s.Object)
+	}
+
+	return nil
+}
+
+// save writes every subscription, secrets and owners included, to WEBHOOKS_FILE
+func (m *Manager) save() {
+
+	if m.File == "" {
+		return
+	}
+
+	type entry struct {
+		Subscription
+		Auid string `json:"auid"`
+	}
+
+	m.mu.RLock()
+	saved := make([]entry, 0, len(m.subscriptions))
+	for _, s := range m.subscriptions {
+		saved = append(saved, entry{*s, s.Auid})
+	}
+	m.mu.RUnlock()
+
+	data, err := json.Marshal(saved)
+	if err == nil {
+		// write and rename so a crash never leaves a partial file
+		if err = ioutil.WriteFile(m.File + ".tmp", data, 0600); err == nil {
+			err = os.Rename(m.File + ".tmp", m.File)
+		}
+	}
+	if err != nil {
+		log.Println(">>> ERROR: WEBHOOKS_FILE - ", err)
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if val := os.Getenv(name); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			return d
+		}
+		log.Println(">>> ERROR: " + name + " is not a duration")
+	}
+	return fallback
+}
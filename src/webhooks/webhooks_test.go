@@ -0,0 +1,225 @@
+package webhooks
+
+import (
+	"net/http/httptest"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// manager is a manager without a hub; its objects are marked as watched so Register doesn't subscribe
+func manager(t *testing.T) *Manager {
+	m := New(nil, 2)
+	m.Backoff = 10*time.Millisecond
+	m.watching["person"] = true
+	return m
+}
+
+// subscribe adds a subscription to url without the Register checks
+func subscribe(m *Manager, url string) Subscription {
+	s := Subscription{ID: randomHex(16), Auid: "u1", Object: "person", URL: url, Secret: "secret", Created: time.Now()}
+	m.mu.Lock()
+	m.subscriptions[s.ID] = &s
+	m.mu.Unlock()
+	return s
+}
+
+func send(m *Manager, s Subscription, payload string) {
+	m.enqueue(&attempt{
+		subscription: s.ID,
+		delivery: Delivery{ID: randomHex(16), Subscription: s.ID, Event: "e1", Type: "created", Status: Pending},
+		payload: []byte(payload),
+	})
+}
+
+// wait polls until the last logged attempt of the subscription has the status
+func wait(t *testing.T, m *Manager, id string, status string) Delivery {
+	deadline := time.Now().Add(5*time.Second)
+	for time.Now().Before(deadline) {
+		if list := m.Deliveries(id); len(list) > 0 && list[0].Status == status {
+			return list[0]
+		}
+		time.Sleep(5*time.Millisecond)
+	}
+	t.Fatalf("no %s delivery, got %+v", status, m.Deliveries(id))
+	return Delivery{}
+}
+
+func TestRegisterRejectsInternalTargets(t *testing.T) {
+
+	m := manager(t)
+	m.AllowHTTP = true
+
+	for _, target := range []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8080/hook",
+		"https://169.254.169.254/latest/meta-data/",
+		"https://10.0.0.5/hook",
+		"https://192.168.1.1/hook",
+		"https://[::1]/hook",
+		"https://[fe80::1]/hook",
+		"https://0.0.0.0/hook",
+		"https://100.64.0.1/hook",
+	} {
+		if _, err := m.Register(Subscription{Auid: "u1", Object: "person", URL: target}); err != ErrTarget {
+			t.Errorf("%s: got %v, want ErrTarget", target, err)
+		}
+	}
+	if len(m.List("u1")) != 0 {
+		t.Fatal("rejected targets were registered")
+	}
+
+	if _, err := m.Register(Subscription{Auid: "u1", Object: "person", URL: "https://8.8.8.8/hook"}); err != nil {
+		t.Fatalf("public address: %v", err)
+	}
+
+	m.AllowPrivate = true
+	if _, err := m.Register(Subscription{Auid: "u1", Object: "person", URL: "http://127.0.0.1/hook"}); err != nil {
+		t.Fatalf("AllowPrivate: %v", err)
+	}
+}
+
+func TestPublic(t *testing.T) {
+
+	for ip, want := range map[string]bool{
+		"8.8.8.8": true,
+		"2606:4700::1111": true,
+		"127.0.0.1": false,
+		"10.1.2.3": false,
+		"172.16.0.1": false,
+		"169.254.169.254": false,
+		"0.0.0.0": false,
+		"::": false,
+		"fd00::1": false,
+		"198.18.0.1": false,
+		"224.0.0.1": false,
+	} {
+		if got := public(net.ParseIP(ip)); got != want {
+			t.Errorf("public(%s) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+
+	var mu sync.Mutex
+	var got *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer receiver.Close()
+
+	m := manager(t)
+	m.AllowPrivate = true
+	s := subscribe(m, receiver.URL)
+
+	send(m, s, `{"id":"e1"}`)
+	wait(t, m, s.ID, Delivered)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if string(body) != `{"id":"e1"}` {
+		t.Fatalf("body = %s", body)
+	}
+	timestamp, err := strconv.ParseInt(got.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "sha256=" + Sign("secret", timestamp, body); got.Header.Get("X-Webhook-Signature") != want {
+		t.Fatalf("signature = %s, want %s", got.Header.Get("X-Webhook-Signature"), want)
+	}
+	if got.Header.Get("X-Webhook-Id") != s.ID || got.Header.Get("X-Webhook-Event") != "created" {
+		t.Fatalf("headers = %v", got.Header)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+
+	var mu sync.Mutex
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	m := manager(t)
+	m.AllowPrivate = true
+	s := subscribe(m, receiver.URL)
+
+	send(m, s, `{}`)
+	d := wait(t, m, s.ID, Delivered)
+
+	if d.Attempt != 3 {
+		t.Fatalf("delivered on attempt %d, want 3", d.Attempt)
+	}
+	if len(m.DeadLetters.List(s.ID)) != 0 {
+		t.Fatal("delivered event was dead lettered")
+	}
+}
+
+func TestDeliverDeadLetter(t *testing.T) {
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	m := manager(t)
+	m.AllowPrivate = true
+	m.MaxAttempts = 3
+	s := subscribe(m, receiver.URL)
+
+	send(m, s, `{"id":"e1"}`)
+	d := wait(t, m, s.ID, Dead)
+
+	if d.Attempt != 3 || d.Error != "target answered 500" {
+		t.Fatalf("dead delivery = %+v", d)
+	}
+	// the attempt is logged just before the letter is stored
+	letters := m.DeadLetters.List(s.ID)
+	for i := 0; i < 100 && len(letters) == 0; i++ {
+		time.Sleep(5*time.Millisecond)
+		letters = m.DeadLetters.List(s.ID)
+	}
+	if len(letters) != 1 || string(letters[0].Payload) != `{"id":"e1"}` {
+		t.Fatalf("dead letters = %+v", letters)
+	}
+}
+
+// a target that passed registration but now resolves to an internal address is refused by the dialer
+func TestDeliverRefusesInternalAddress(t *testing.T) {
+
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer receiver.Close()
+
+	m := manager(t)
+	m.MaxAttempts = 1
+	s := subscribe(m, receiver.URL)
+
+	send(m, s, `{}`)
+	d := wait(t, m, s.ID, Dead)
+
+	if calls != 0 {
+		t.Fatal("delivery reached a loopback receiver")
+	}
+	if !strings.Contains(d.Error, ErrTarget.Error()) {
+		t.Fatalf("error = %s", d.Error)
+	}
+}